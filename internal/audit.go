@@ -0,0 +1,283 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// 审计日志：控制台操作与同步引擎对宝塔 / DNS / K8s 的修改都会留下一条结构化记录
+// 记录先输出到标准输出，再写入 AUDIT_CONFIGMAP 持久化 (多副本共用，乐观并发写入)：
+// 控制台操作与同步引擎的删除类操作 (删除反代 / 站点、反向删除路由、删除 DNS 记录) 同步写入，写入成功后才返回；
+// 其余同步引擎的记录经内存队列批量写入，队列已满时阻塞等待而不是丢弃，
+// 最终仍写入失败的记录只保留在标准输出中，并计入 kube_bt_sync_audit_entries_lost_total
+
+const (
+	AuditActionRouteApply         = "route.apply"
+	AuditActionRouteRollback      = "route.rollback"
+	AuditActionRouteDelete        = "route.delete"
+	AuditActionRouteReverseDelete = "route.reverse-delete" // 宝塔端站点连续缺失时反向删除路由
+	AuditActionBaotaProvision     = "baota.provision"
+	AuditActionBaotaDeleteProxy   = "baota.delete-proxy"
+	AuditActionBaotaDeleteSite    = "baota.delete-site"
+	AuditActionDNSUpsert          = "dns.upsert"
+	AuditActionDNSDelete          = "dns.delete"
+	AuditActionNginxReload        = "nginx.reload"
+)
+
+// 同步引擎发起的操作使用的操作人
+const AuditActorController = "controller"
+
+const (
+	auditDataKey = "entries.json"
+	// ConfigMap 上限为 1MiB，留出余量；超出时丢弃最旧的记录
+	auditMaxBytes = 900 * 1024
+	// before / after 单项保留的最大长度
+	auditMaxSnapshot = 8 * 1024
+)
+
+// AuditEntry 一条审计记录
+type AuditEntry struct {
+	Time   string `json:"time"`
+	Actor  string `json:"actor"`
+	Action string `json:"action"`
+	Target string `json:"target"`
+	Result string `json:"result"` // success / failure
+	Error  string `json:"error,omitempty"`
+	Detail string `json:"detail,omitempty"`
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+// AuditFilter /api/audit 的过滤条件，为空的条件不生效
+type AuditFilter struct {
+	Actor  string // 包含匹配
+	Action string // 前缀匹配，例如 "baota" 匹配全部宝塔操作
+	Target string // 包含匹配
+	Result string // success / failure
+	Limit  int
+}
+
+var auditClient *kubernetes.Clientset
+var auditCfg Config
+var auditQueue = make(chan AuditEntry, 256)
+
+// StartAuditLog 启动审计日志的后台持久化；未启动前产生的记录会在队列中等待
+func StartAuditLog(clientset *kubernetes.Clientset, cfg Config) {
+	auditClient, auditCfg = clientset, cfg
+	go runAuditWriter()
+}
+
+// recordAudit 记录一次同步引擎的常规操作 (异步批量写入)；err 为空表示成功
+func recordAudit(actor, action, target, detail, before, after string, err error) {
+	enqueueAudit(newAuditEntry(actor, action, target, detail, before, after, err))
+}
+
+// recordAuditNow 记录一次控制台操作或同步引擎的删除类操作，同步写入 ConfigMap (失败时退回异步队列重试)
+func recordAuditNow(actor, action, target, detail, before, after string, err error) {
+	entry := newAuditEntry(actor, action, target, detail, before, after, err)
+	if auditClient != nil {
+		persistErr := persistAudit([]AuditEntry{entry})
+		if persistErr == nil {
+			return
+		}
+		slog.Warn("写入审计 ConfigMap 失败，转入后台重试", "action", action, "target", target, "error", persistErr)
+	}
+	enqueueAudit(entry)
+}
+
+// enqueueAudit 投递到后台写入队列；队列已满时阻塞等待写入协程腾出空间，不丢弃记录
+func enqueueAudit(entry AuditEntry) {
+	select {
+	case auditQueue <- entry:
+	default:
+		auditQueueFull.Inc()
+		slog.Warn("审计队列已满，等待写入", "action", entry.Action, "target", entry.Target)
+		auditQueue <- entry
+	}
+}
+
+func newAuditEntry(actor, action, target, detail, before, after string, err error) AuditEntry {
+	entry := AuditEntry{
+		Time:   time.Now().Format("2006-01-02 15:04:05"),
+		Actor:  actor,
+		Action: action,
+		Target: target,
+		Result: "success",
+		Detail: detail,
+		Before: truncateSnapshot(before),
+		After:  truncateSnapshot(after),
+	}
+	if err != nil {
+		entry.Result, entry.Error = "failure", err.Error()
+	}
+	slog.Info("审计", "audit", true, "actor", actor, "action", action, "target", target, "result", entry.Result, "error", entry.Error, "detail", detail)
+	return entry
+}
+
+func truncateSnapshot(s string) string {
+	if len(s) <= auditMaxSnapshot {
+		return s
+	}
+	return s[:auditMaxSnapshot] + "\n... (已截断)"
+}
+
+// runAuditWriter 批量写入：一次取出队列中所有待写记录，合并为一次 ConfigMap 更新
+func runAuditWriter() {
+	for entry := range auditQueue {
+		batch := []AuditEntry{entry}
+	drain:
+		for len(batch) < 100 {
+			select {
+			case e := <-auditQueue:
+				batch = append(batch, e)
+			default:
+				break drain
+			}
+		}
+		err := persistAudit(batch)
+		if err != nil {
+			// API Server 短暂不可用时稍后再试一次
+			time.Sleep(5 * time.Second)
+			err = persistAudit(batch)
+		}
+		if err != nil {
+			auditEntriesLost.Add(float64(len(batch)))
+			slog.Error("写入审计 ConfigMap 失败，记录只保留在标准输出中", "count", len(batch), "error", err)
+		}
+	}
+}
+
+func persistAudit(batch []AuditEntry) error {
+	client := auditClient.CoreV1().ConfigMaps(auditCfg.PodNamespace)
+	retriable := func(err error) bool { return apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err) }
+	return retry.OnError(retry.DefaultRetry, retriable, func() error {
+		cm, err := client.Get(context.TODO(), auditCfg.AuditConfigMap, metav1.GetOptions{})
+		notFound := apierrors.IsNotFound(err)
+		if notFound {
+			cm = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      auditCfg.AuditConfigMap,
+					Namespace: auditCfg.PodNamespace,
+					Labels:    map[string]string{"app.kubernetes.io/managed-by": "kube-bt-sync"},
+				},
+			}
+		} else if err != nil {
+			return err
+		}
+
+		entries, err := decodeAudit(cm)
+		if err != nil {
+			// 内容无法解析：原始内容另存成功后才重新开始记录，另存失败时拒绝写入，绝不直接覆盖
+			auditCorrupt.Inc()
+			backup, saveErr := preserveCorruptAudit(cm)
+			if saveErr != nil {
+				return fmt.Errorf("%v，另存原始内容失败，拒绝覆盖: %w", err, saveErr)
+			}
+			slog.Error("审计 ConfigMap 内容损坏，原始内容已另存，审计记录重新开始", "configmap", backup, "error", err)
+			entries = nil
+		}
+		entries = append(entries, batch...)
+		if len(entries) > auditCfg.AuditLimit {
+			entries = entries[len(entries)-auditCfg.AuditLimit:]
+		}
+		data, err := json.Marshal(entries)
+		for err == nil && len(data) > auditMaxBytes && len(entries) > 1 {
+			entries = entries[len(entries)/10+1:]
+			data, err = json.Marshal(entries)
+		}
+		if err != nil {
+			return err
+		}
+
+		if cm.Data == nil {
+			cm.Data = make(map[string]string)
+		}
+		cm.Data[auditDataKey] = string(data)
+		if notFound {
+			_, err = client.Create(context.TODO(), cm, metav1.CreateOptions{})
+		} else {
+			_, err = client.Update(context.TODO(), cm, metav1.UpdateOptions{})
+		}
+		return err
+	})
+}
+
+// preserveCorruptAudit 把无法解析的审计内容原样另存到 <AUDIT_CONFIGMAP>-corrupt-<resourceVersion>
+// 名称由 resourceVersion 决定，冲突重试时不会重复另存同一份内容
+func preserveCorruptAudit(cm *corev1.ConfigMap) (string, error) {
+	backup := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        fmt.Sprintf("%s-corrupt-%s", auditCfg.AuditConfigMap, cm.ResourceVersion),
+			Namespace:   auditCfg.PodNamespace,
+			Labels:      map[string]string{"app.kubernetes.io/managed-by": "kube-bt-sync"},
+			Annotations: map[string]string{"kube-bt-sync.io/corrupted-at": time.Now().Format(time.RFC3339)},
+		},
+		Data: cm.Data,
+	}
+	_, err := auditClient.CoreV1().ConfigMaps(auditCfg.PodNamespace).Create(context.TODO(), backup, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		err = nil
+	}
+	return backup.Name, err
+}
+
+func decodeAudit(cm *corev1.ConfigMap) ([]AuditEntry, error) {
+	raw, ok := cm.Data[auditDataKey]
+	if !ok {
+		return nil, nil
+	}
+	var entries []AuditEntry
+	if err := json.Unmarshal([]byte(raw), &entries); err != nil {
+		return nil, fmt.Errorf("审计 ConfigMap 内容损坏: %w", err)
+	}
+	return entries, nil
+}
+
+// QueryAudit 按时间倒序返回符合条件的审计记录
+func QueryAudit(clientset *kubernetes.Clientset, cfg Config, filter AuditFilter) ([]AuditEntry, error) {
+	cm, err := clientset.CoreV1().ConfigMaps(cfg.PodNamespace).Get(context.TODO(), cfg.AuditConfigMap, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return []AuditEntry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries, err := decodeAudit(cm)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]AuditEntry, 0)
+	for i := len(entries) - 1; i >= 0 && (filter.Limit <= 0 || len(result) < filter.Limit); i-- {
+		e := entries[i]
+		if filter.Actor != "" && !strings.Contains(e.Actor, filter.Actor) {
+			continue
+		}
+		if filter.Action != "" && !strings.HasPrefix(e.Action, filter.Action) {
+			continue
+		}
+		if filter.Target != "" && !strings.Contains(e.Target, filter.Target) {
+			continue
+		}
+		if filter.Result != "" && e.Result != filter.Result {
+			continue
+		}
+		result = append(result, e)
+	}
+	return result, nil
+}
+
+// routeTarget 审计记录中路由的统一写法
+func routeTarget(kind, namespace, name string) string {
+	return fmt.Sprintf("%s %s/%s", normalizeKind(kind), namespace, name)
+}
@@ -0,0 +1,122 @@
+package internal
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// useTestAudit 让审计写入指向内存中的 ConfigMap 存储，测试结束后恢复
+func useTestAudit(t *testing.T) *fakeConfigMaps {
+	t.Helper()
+	store := newFakeConfigMaps()
+	savedClient, savedCfg := auditClient, auditCfg
+	auditClient = newTestClientset(t, store)
+	auditCfg = Config{PodNamespace: "tools", AuditConfigMap: "kube-bt-sync-audit", AuditLimit: 1000}
+	t.Cleanup(func() { auditClient, auditCfg = savedClient, savedCfg })
+	return store
+}
+
+func TestRecordAuditNowPersistsSynchronously(t *testing.T) {
+	store := useTestAudit(t)
+	recordAuditNow(AuditActorController, AuditActionBaotaDeleteSite, "a.example.com", "删除策略 delete-site", "http://home:38333", "", nil)
+	recordAuditNow(AuditActorController, AuditActionBaotaDeleteProxy, "b.example.com", "删除策略 delete-proxy", "", "", errors.New("宝塔超时"))
+
+	cm := store.get("tools", "kube-bt-sync-audit")
+	if cm == nil {
+		t.Fatal("recordAuditNow() 返回后审计 ConfigMap 仍不存在")
+	}
+	entries, err := decodeAudit(cm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Target != "a.example.com" || entries[1].Result != "failure" {
+		t.Errorf("审计记录 = %+v", entries)
+	}
+	if len(auditQueue) != 0 {
+		t.Errorf("写入成功时不应再投递到异步队列")
+	}
+}
+
+func TestEnqueueAuditBlocksWhenFull(t *testing.T) {
+	defer func() {
+		for len(auditQueue) > 0 {
+			<-auditQueue
+		}
+	}()
+	for len(auditQueue) < cap(auditQueue) {
+		auditQueue <- AuditEntry{Action: "filler"}
+	}
+	before := testutil.ToFloat64(auditQueueFull)
+
+	done := make(chan struct{})
+	go func() {
+		enqueueAudit(AuditEntry{Action: AuditActionBaotaProvision})
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("队列已满时 enqueueAudit() 应等待，而不是丢弃记录")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	<-auditQueue
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("队列腾出空间后 enqueueAudit() 仍未返回")
+	}
+	if got := testutil.ToFloat64(auditQueueFull) - before; got != 1 {
+		t.Errorf("auditQueueFull 增加了 %v, want 1", got)
+	}
+}
+
+func TestPersistAuditPreservesCorruptPayload(t *testing.T) {
+	store := useTestAudit(t)
+	store.put(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "tools", Name: "kube-bt-sync-audit"},
+		Data:       map[string]string{auditDataKey: `[{"time":"2026-01-01 00:00:00"`},
+	})
+	original := store.get("tools", "kube-bt-sync-audit")
+
+	if err := persistAudit([]AuditEntry{{Action: AuditActionRouteApply, Target: "Ingress app/web"}}); err != nil {
+		t.Fatalf("persistAudit() error = %v", err)
+	}
+	backup := store.get("tools", "kube-bt-sync-audit-corrupt-"+original.ResourceVersion)
+	if backup == nil || backup.Data[auditDataKey] != original.Data[auditDataKey] {
+		t.Fatalf("损坏的审计内容未被原样另存: %+v", backup)
+	}
+	entries, err := decodeAudit(store.get("tools", "kube-bt-sync-audit"))
+	if err != nil || len(entries) != 1 || entries[0].Target != "Ingress app/web" {
+		t.Errorf("另存后应重新开始记录: entries=%+v err=%v", entries, err)
+	}
+}
+
+func TestPersistAuditRefusesToOverwriteWithoutBackup(t *testing.T) {
+	store := useTestAudit(t)
+	corrupt := `not json`
+	store.put(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "tools", Name: "kube-bt-sync-audit"},
+		Data:       map[string]string{auditDataKey: corrupt},
+	})
+	// 另存用的 ConfigMap 无法创建 (例如缺少权限)
+	auditClient = newTestClientset(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			writeStatus(w, http.StatusForbidden, "Forbidden")
+			return
+		}
+		store.ServeHTTP(w, r)
+	}))
+
+	if err := persistAudit([]AuditEntry{{Action: AuditActionRouteApply}}); err == nil {
+		t.Fatal("另存失败时 persistAudit() 应返回错误")
+	}
+	if got := store.get("tools", "kube-bt-sync-audit").Data[auditDataKey]; got != corrupt {
+		t.Errorf("另存失败时审计内容被覆盖为 %q", got)
+	}
+}
@@ -3,14 +3,20 @@ package internal
 import (
 	"crypto/md5"
 	"crypto/tls" // 【新增】用于配置 TLS 证书忽略
+	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 )
 
+// ProxyName kube-bt-sync 在每个宝塔站点下注入的反代规则名称
+const ProxyName = "kube-bt-sync-proxy"
+
 func CallBaotaAPI(cfg Config, apiPath string, params map[string]string) (string, error) {
 	timestamp := fmt.Sprintf("%d", time.Now().Unix())
 	md5Key := fmt.Sprintf("%x", md5.Sum([]byte(cfg.BaotaAPIKey)))
@@ -47,15 +53,411 @@ func CallBaotaAPI(cfg Config, apiPath string, params map[string]string) (string,
 		Transport: customTransport,
 	}
 
+	action := baotaAction(apiPath)
+	start := time.Now()
+	// 超时等传输错误往往是最慢的调用，所有返回路径都计入耗时
+	defer func() { baotaAPIDuration.WithLabelValues(action).Observe(time.Since(start).Seconds()) }()
 	resp, err := client.Do(req)
 	if err != nil {
+		baotaAPIErrors.WithLabelValues(action, "transport").Inc()
+		// 只记录接口名，请求参数中带有签名，不能输出
+		slog.Warn("调用宝塔接口失败", "action", action, "duration", time.Since(start), "error", err)
 		return "", err
 	}
 	defer resp.Body.Close()
 
 	bodyBytes, err := io.ReadAll(resp.Body)
+	slog.Debug("调用宝塔接口", "action", action, "status", resp.StatusCode, "duration", time.Since(start))
 	if err != nil {
+		baotaAPIErrors.WithLabelValues(action, "transport").Inc()
 		return "", err
 	}
-	return string(bodyBytes), nil
+	body := string(bodyBytes)
+	switch {
+	case resp.StatusCode >= 300:
+		baotaAPIErrors.WithLabelValues(action, "http").Inc()
+	case strings.Contains(body, `"status": false`) || strings.Contains(body, `"status":false`):
+		baotaAPIErrors.WithLabelValues(action, "api").Inc()
+	}
+	return body, nil
+}
+
+// 宝塔新建站点、修改反代都会重载 Nginx，同一面板上并发重载容易导致 Nginx 假死
+// 因此会触发重载的调用按面板串行执行，只读查询不受限制
+var panelLocks = make(map[string]*sync.Mutex)
+var panelLocksMutex sync.Mutex
+
+// lockPanel 获取面板的重载锁，需要排队时在该域名的进度上提示，返回解锁函数
+func lockPanel(cfg Config, domain string) func() {
+	panelLocksMutex.Lock()
+	lock, ok := panelLocks[cfg.BaotaURL]
+	if !ok {
+		lock = &sync.Mutex{}
+		panelLocks[cfg.BaotaURL] = lock
+	}
+	panelLocksMutex.Unlock()
+
+	if !lock.TryLock() {
+		updateProgress(domain, "⏳ 排队中：等待面板完成其它域名的 Nginx 重载...")
+		lock.Lock()
+	}
+	return lock.Unlock
+}
+
+// 轮询宝塔就绪状态的间隔
+const baotaPollInterval = 500 * time.Millisecond
+
+// waitForBaota 轮询宝塔直到 ready 返回 true (站点/反代真正落地)，超过 BAOTA_READY_TIMEOUT_SEC 视为失败
+// 轮询期间的查询错误只作为超时时的附加信息，不会提前中断
+func waitForBaota(cfg Config, what string, ready func() (bool, error)) error {
+	deadline := time.Now().Add(cfg.BaotaReadyTimeout)
+	var lastErr error
+	for {
+		ok, err := ready()
+		if err == nil && ok {
+			return nil
+		}
+		if err != nil {
+			lastErr = err
+		}
+		if time.Now().After(deadline) {
+			if lastErr != nil {
+				return fmt.Errorf("等待%s超时 (%v): %w", what, cfg.BaotaReadyTimeout, lastErr)
+			}
+			return fmt.Errorf("等待%s超时 (%v)", what, cfg.BaotaReadyTimeout)
+		}
+		time.Sleep(baotaPollInterval)
+	}
+}
+
+// isBaotaError 宝塔接口出错时大多仍返回 200，只能通过返回内容里的关键字判断
+func isBaotaError(resp string) bool {
+	return strings.Contains(resp, "错误") || strings.Contains(resp, "失败") || strings.Contains(resp, "error")
+}
+
+// findBaotaSiteID 在宝塔站点列表中精确查找域名对应的站点 ID，found=false 表示站点不存在
+func findBaotaSiteID(cfg Config, domain string) (id int, found bool, err error) {
+	resp, err := CallBaotaAPI(cfg, "/data?action=getData", map[string]string{"table": "sites", "search": domain})
+	if err != nil {
+		return 0, false, err
+	}
+	var siteData struct { Data []struct { Id int `json:"id"`; Name string `json:"name"` } `json:"data"` }
+	if err := json.Unmarshal([]byte(resp), &siteData); err != nil {
+		return 0, false, fmt.Errorf("解析宝塔站点列表失败: %w", err)
+	}
+	for _, site := range siteData.Data {
+		if site.Name == domain {
+			return site.Id, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// DeleteBaotaSite 删除宝塔站点（连同其下的反代配置），站点本就不存在时视为成功
+func DeleteBaotaSite(cfg Config, domain string) error {
+	id, found, err := findBaotaSiteID(cfg, domain)
+	if err != nil || !found {
+		return err
+	}
+	defer lockPanel(cfg, domain)()
+	resp, err := CallBaotaAPI(cfg, "/site?action=DeleteSite", map[string]string{"id": fmt.Sprintf("%d", id), "webname": domain})
+	if err != nil {
+		return err
+	}
+	if isBaotaError(resp) {
+		return fmt.Errorf("宝塔拒绝删除站点: %s", resp)
+	}
+	return nil
+}
+
+// DeleteBaotaProxy 仅移除 kube-bt-sync 注入的反代规则，保留站点本身，站点不存在时视为成功
+func DeleteBaotaProxy(cfg Config, domain string) error {
+	if _, found, err := findBaotaSiteID(cfg, domain); err != nil || !found {
+		return err
+	}
+	defer lockPanel(cfg, domain)()
+	resp, err := CallBaotaAPI(cfg, "/site?action=RemoveProxy", map[string]string{"sitename": domain, "proxyname": ProxyName})
+	if err != nil {
+		return err
+	}
+	if isBaotaError(resp) {
+		return fmt.Errorf("宝塔拒绝移除反代: %s", resp)
+	}
+	return nil
+}
+
+// BaotaProxy 宝塔站点下的一条反向代理配置 (GetProxyList 返回的字段子集)
+type BaotaProxy struct {
+	ProxyName string      `json:"proxyname"`
+	ProxyDir  string      `json:"proxydir"`
+	ProxySite string      `json:"proxysite"`
+	ToDomain  string      `json:"todomain"`
+	Type      interface{} `json:"type"` // 1 为启用，不同版本面板可能返回数字或字符串
+}
+
+// Enabled 反代规则是否处于启用状态
+func (p BaotaProxy) Enabled() bool {
+	return fmt.Sprint(p.Type) == "1"
+}
+
+// getBaotaProxy 读取站点下由 kube-bt-sync 注入的反代规则，不存在时返回 nil
+func getBaotaProxy(cfg Config, domain string) (*BaotaProxy, error) {
+	resp, err := CallBaotaAPI(cfg, "/site?action=GetProxyList", map[string]string{"sitename": domain})
+	if err != nil {
+		return nil, err
+	}
+	var proxies []BaotaProxy
+	if err := json.Unmarshal([]byte(resp), &proxies); err != nil {
+		// 站点不存在等情况下宝塔返回的是 {"status": false, "msg": ...}
+		return nil, fmt.Errorf("读取反代列表失败: %s", resp)
+	}
+	for _, p := range proxies {
+		if p.ProxyName == ProxyName {
+			return &p, nil
+		}
+	}
+	return nil, nil
+}
+
+// 写入宝塔反代配置文件中的托管片段的起止标记，重新下发时整段替换
+const (
+	upstreamTLSBegin = "    # kube-bt-sync:upstream-tls begin"
+	upstreamTLSEnd   = "    # kube-bt-sync:upstream-tls end"
+	accessRulesBegin = "    # kube-bt-sync:access begin"
+	accessRulesEnd   = "    # kube-bt-sync:access end"
+	resolverBegin    = "    # kube-bt-sync:resolver begin"
+	resolverEnd      = "    # kube-bt-sync:resolver end"
+)
+
+// resolver 片段中保存的原始 proxy_pass，移除片段时据此还原
+const resolverOriginalPrefix = "    # kube-bt-sync:original "
+
+// 变量形式的上游：Nginx 只有在 proxy_pass 使用变量时才会按 resolver 周期性重新解析域名
+const resolverUpstreamVar = "$kube_bt_sync_upstream"
+
+// baotaProxyConfPath 宝塔为站点反代规则生成的 Nginx 配置文件 (proxy/<站点>/<md5(规则名)>_<站点>.conf)
+func baotaProxyConfPath(domain string) string {
+	return fmt.Sprintf("/www/server/panel/vhost/nginx/proxy/%s/%x_%s.conf", domain, md5.Sum([]byte(ProxyName)), domain)
+}
+
+// applyProxyConf 宝塔反代 API 不支持的选项直接写入反代配置文件，紧跟在 proxy_pass 之后：
+//   - https 上游：以访问域名作为 SNI (家庭 Ingress 据此选择证书)，按需开启证书校验
+//   - 访问控制：allow / deny 规则
+//   - 配置了 NGINX_RESOLVER 时把 proxy_pass 改写为变量形式，DDNS 的 IP 变化后无需重载 Nginx
+//
+// 选项为空时移除对应片段；内容无变化时不写文件也不重载
+func applyProxyConf(cfg Config, domain string, up Upstream, access AccessRules) error {
+	path := baotaProxyConfPath(domain)
+	resp, err := CallBaotaAPI(cfg, "/files?action=GetFileBody", map[string]string{"path": path})
+	if err != nil {
+		return err
+	}
+	var file struct {
+		Status bool   `json:"status"`
+		Data   string `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(resp), &file); err != nil || !file.Status {
+		return fmt.Errorf("读取反代配置文件 %s 失败: %s", path, resp)
+	}
+
+	original := file.Data
+	content := stripManagedBlock(stripManagedBlock(original, upstreamTLSBegin, upstreamTLSEnd), accessRulesBegin, accessRulesEnd)
+	content = stripResolver(content)
+	if !access.Empty() {
+		content = injectAfterProxyPass(content, accessRulesBegin, accessRulesEnd, access.directives())
+	}
+	if up.Scheme == "https" {
+		content = injectAfterProxyPass(content, upstreamTLSBegin, upstreamTLSEnd, upstreamTLSDirectives(content, cfg, up))
+	}
+	if cfg.NginxResolver != "" {
+		content = injectResolver(content, cfg.NginxResolver)
+	}
+	if content == original {
+		return nil
+	}
+
+	if err := saveBaotaFile(cfg, path, content); err != nil {
+		return err
+	}
+	if err := reloadBaotaNginx(cfg); err != nil {
+		// 重载失败时还原配置文件，避免留下一份让 Nginx 无法启动的配置
+		saveBaotaFile(cfg, path, original)
+		return fmt.Errorf("写入反代扩展配置后重载 Nginx 失败，已还原: %w", err)
+	}
+	return nil
+}
+
+// reloadBaotaNginx 通过宝塔重载 Nginx
+func reloadBaotaNginx(cfg Config) error {
+	resp, err := CallBaotaAPI(cfg, "/system?action=ServiceAdmin", map[string]string{"name": "nginx", "type": "reload"})
+	if err == nil && isBaotaError(resp) {
+		err = fmt.Errorf("%s", resp)
+	}
+	return err
+}
+
+func saveBaotaFile(cfg Config, path, content string) error {
+	resp, err := CallBaotaAPI(cfg, "/files?action=SaveFileBody", map[string]string{"path": path, "data": content, "encoding": "utf-8"})
+	if err != nil {
+		return err
+	}
+	if isBaotaError(resp) || !strings.Contains(resp, "true") {
+		return fmt.Errorf("宝塔拒绝保存文件 %s: %s", path, resp)
+	}
+	return nil
+}
+
+func stripManagedBlock(content, begin, end string) string {
+	start := strings.Index(content, begin)
+	stop := strings.Index(content, end)
+	if start < 0 || stop < start {
+		return content
+	}
+	return content[:start] + strings.TrimPrefix(content[stop+len(end):], "\n")
+}
+
+// injectResolver 把 proxy_pass 改写为 resolver + 变量形式，原始的 proxy_pass 以注释保存在片段中
+// 上游不带路径时，变量形式的 proxy_pass 与原写法一样原样转发请求 URI
+func injectResolver(content, resolver string) string {
+	if !strings.Contains(resolver, "valid=") {
+		resolver += " valid=60s"
+	}
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmed, "proxy_pass ") {
+			continue
+		}
+		target := strings.TrimSuffix(strings.TrimSpace(strings.TrimPrefix(trimmed, "proxy_pass ")), ";")
+		block := []string{
+			resolverBegin,
+			resolverOriginalPrefix + trimmed,
+			"    resolver " + resolver + ";",
+			"    resolver_timeout 5s;",
+			"    set " + resolverUpstreamVar + " " + target + ";",
+			"    proxy_pass " + resolverUpstreamVar + ";",
+			resolverEnd,
+		}
+		rest := append([]string{}, lines[i+1:]...)
+		return strings.Join(append(append(lines[:i], block...), rest...), "\n")
+	}
+	return content
+}
+
+// stripResolver 移除 resolver 片段并还原原始的 proxy_pass
+func stripResolver(content string) string {
+	start := strings.Index(content, resolverBegin)
+	stop := strings.Index(content, resolverEnd)
+	if start < 0 || stop < start {
+		return content
+	}
+	original := ""
+	for _, line := range strings.Split(content[start:stop], "\n") {
+		if strings.HasPrefix(line, resolverOriginalPrefix) {
+			original = "    " + strings.TrimPrefix(line, resolverOriginalPrefix)
+		}
+	}
+	return content[:start] + original + content[stop+len(resolverEnd):]
+}
+
+// upstreamTLSDirectives https 上游需要的指令，宝塔模板中已有的指令不重复添加
+func upstreamTLSDirectives(content string, cfg Config, up Upstream) []string {
+	directives := []string{
+		"proxy_ssl_server_name on;",
+		"proxy_ssl_name $host;",
+	}
+	if up.VerifyTLS {
+		directives = append(directives,
+			"proxy_ssl_verify on;",
+			"proxy_ssl_verify_depth 3;",
+			"proxy_ssl_trusted_certificate "+cfg.UpstreamCABundle+";",
+		)
+	} else {
+		directives = append(directives, "proxy_ssl_verify off;")
+	}
+
+	var result []string
+	for _, d := range directives {
+		if !strings.Contains(content, strings.Fields(d)[0]+" ") {
+			result = append(result, d)
+		}
+	}
+	return result
+}
+
+// injectAfterProxyPass 紧跟在 proxy_pass 之后插入一段带起止标记的指令
+func injectAfterProxyPass(content, begin, end string, directives []string) string {
+	block := []string{begin}
+	for _, d := range directives {
+		block = append(block, "    "+d)
+	}
+	block = append(block, end)
+
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "proxy_pass ") {
+			rest := append([]string{}, lines[i+1:]...)
+			return strings.Join(append(append(lines[:i+1], block...), rest...), "\n")
+		}
+	}
+	return content
+}
+
+// ensureBaotaSSL 按 SSL 模式处理宝塔站点证书：letsencrypt 申请证书，force-https 额外开启强制 HTTPS
+// 模式为空 (none) 时不触碰站点现有的 SSL 配置
+func ensureBaotaSSL(cfg Config, domain, mode string) error {
+	if mode == "" || mode == SSLModeNone {
+		return nil
+	}
+	resp, err := CallBaotaAPI(cfg, "/site?action=GetSSL", map[string]string{"siteName": domain})
+	if err != nil {
+		return err
+	}
+	var ssl struct {
+		Status      bool `json:"status"`
+		HTTPToHTTPS bool `json:"httpTohttps"`
+	}
+	if err := json.Unmarshal([]byte(resp), &ssl); err != nil {
+		return fmt.Errorf("读取站点 SSL 状态失败: %s", resp)
+	}
+
+	if !ssl.Status {
+		id, found, err := findBaotaSiteID(cfg, domain)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("站点 %s 不存在，无法申请证书", domain)
+		}
+		siteID := fmt.Sprintf("%d", id)
+		domains, _ := json.Marshal([]string{domain})
+		resp, err := CallBaotaAPI(cfg, "/acme?action=apply_cert_api", map[string]string{
+			"domains": string(domains), "auth_type": "http", "auth_to": siteID, "auto_wildcard": "0", "id": siteID,
+		})
+		if err != nil {
+			return err
+		}
+		if isBaotaError(resp) || strings.Contains(resp, `"status": false`) || strings.Contains(resp, `"status":false`) {
+			return fmt.Errorf("申请 Let's Encrypt 证书失败: %s", resp)
+		}
+	}
+
+	action := ""
+	switch {
+	case mode == SSLModeForceHTTPS && !ssl.HTTPToHTTPS:
+		action = "HttpToHttps"
+	case mode == SSLModeLetsEncrypt && ssl.HTTPToHTTPS:
+		action = "CloseToHttps"
+	}
+	if action == "" {
+		return nil
+	}
+	resp, err = CallBaotaAPI(cfg, "/site?action="+action, map[string]string{"siteName": domain})
+	if err != nil {
+		return err
+	}
+	if isBaotaError(resp) {
+		return fmt.Errorf("宝塔拒绝切换强制 HTTPS: %s", resp)
+	}
+	return nil
 }
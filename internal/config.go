@@ -2,8 +2,19 @@ package internal
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
+	"strings"
 	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// 深度巡检发现宝塔端站点缺失时的处理策略
+const (
+	MissingSitePolicyRecreate      = "recreate"       // 重新创建站点与反代 (默认)
+	MissingSitePolicyReport        = "report"         // 仅在同步历史中报告漂移
+	MissingSitePolicyDeleteIngress = "delete-ingress" // 连续确认 N 次后删除 K8s Ingress
 )
 
 type Config struct {
@@ -11,17 +22,204 @@ type Config struct {
 	BaotaAPIKey  string
 	DDNSHost     string
 	DefaultPort  string
+	HTTPSPort    string // 家庭 Ingress 的外网 HTTPS 端口，也是 https 上游的默认端口
 	SyncInterval time.Duration
+	SyncWorkers  int // 并发同步的域名数量
+
+	BaotaReadyTimeout time.Duration // 建站/下发反代后等待宝塔端就绪的最长时间
+	UpstreamCABundle  string        // https 上游开启证书校验时，宝塔服务器上的 CA 证书路径
+
+	NginxResolver      string        // 宝塔 Nginx 使用的 DNS 服务器，配置后反代改为变量形式的上游，按 TTL 重新解析 DDNS 域名
+	DDNSReloadOnChange bool          // 未配置 NGINX_RESOLVER 时，监测到 DDNS 域名的 IP 变化后重载宝塔 Nginx
+	DDNSWatchInterval  time.Duration // 监测 DDNS 域名解析结果的间隔
+
+	ProbeEnabled      bool          // 同步成功后经由宝塔服务器做一次端到端探测
+	ProbeAddr         string        // 探测连接的宝塔服务器地址 (host:port)，为空时取 BAOTA_URL 主机的 80 端口
+	ProbeDNSServer    string        // 配置后改为通过该公共 DNS 解析域名再探测
+	ProbePath         string        // 探测请求的路径
+	ProbeTimeout      time.Duration // 单次探测请求的超时时间
+	ProbeExpectStatus int           // 经由宝塔访问时期望的状态码，为 0 时改为与直连 Ingress 的状态码比对
+	ProbeExpectBody   string        // 经由宝塔访问时响应体中必须包含的固定标识，配置后以此判断响应来自 Ingress，为空时与直连 Ingress 的响应比对
+
+	DNSProvider     string // 为已同步的域名自动维护公网 DNS 记录：为空表示不启用 / rfc2136
+	DNSRecordTarget string // 记录指向的宝塔服务器：IP 生成 A/AAAA 记录，域名生成 CNAME 记录；为空时取 BAOTA_URL 的主机
+	DNSTTL          int
+	DNSOwnerID      string // 归属标记中的实例标识，多个实例共用一个区域时必须不同
+
+	DDNSUpdate         bool   // 内置 DDNS 更新器：探测家庭公网 IP 并通过 DNS 服务商更新 DDNS_HOST
+	DDNSIPSource       string // 公网 IP 来源：IP 回显服务的 URL，或 iface:<网卡名>
+	DDNSUpdateInterval time.Duration
+
+	RFC2136Server        string // 权威 DNS 服务器 (host:port)
+	RFC2136Zone          string // 允许动态更新的区域，域名必须位于该区域内
+	RFC2136TSIGKeyName   string
+	RFC2136TSIGSecret    string // base64 编码的 TSIG 密钥
+	RFC2136TSIGAlgorithm string
+
+	MissingSitePolicy        string
+	MissingSiteConfirmations int
+
+	DryRun bool // 只计算并记录将要执行的动作，不修改宝塔与 Ingress
+
+	PodNamespace   string // 本程序所在的命名空间，用于存放状态 ConfigMap 等
+	StateConfigMap string // 持久化同步记录的 ConfigMap 名称
+
+	RevisionConfigMap string // 保存控制台下发的路由修订记录的 ConfigMap 名称
+	RevisionLimit     int    // 每条路由最多保留的修订数量
+
+	AuditConfigMap string // 持久化审计日志的 ConfigMap 名称
+	AuditLimit     int    // 最多保留的审计记录条数 (同时受 ConfigMap 1MiB 上限约束)
+
+	MetricsAddr string // Prometheus 指标的监听地址，与控制台端口分开，为空表示不启用
+
+	WatchNamespaces  []string // 只管理这些命名空间下的 Ingress，为空表示全部命名空间
+	LabelSelector    string   // 只管理匹配该标签选择器的 Ingress
+	IngressClass     string   // 只管理该 IngressClass (NAT 端口背后的 Ingress 控制器) 的 Ingress，为空表示不过滤
+	GatewayAPI       string   // 是否同步 Gateway API HTTPRoute：auto (检测到即启用) / true / false
+	GatewayName      string   // 只管理挂载在该 Gateway (NAT 端口背后的那个) 上的 HTTPRoute，为空表示不过滤
+	GatewayNamespace string   // GatewayName 所在的命名空间，为空时只比对名称
+
+	LeaderElection   bool   // 多副本部署时基于 Lease 选主，只有 Leader 执行同步
+	LeaderElectionID string // 选主使用的 Lease 名称
+	PodName          string // 选主身份
 }
 
 func LoadConfig() Config {
-	return Config{
+	cfg := Config{
 		BaotaURL:     getEnv("BAOTA_URL", "http://127.0.0.1:8888"),
 		BaotaAPIKey:  getEnv("BAOTA_API_KEY", ""), // 必须配置
 		DDNSHost:     getEnv("DDNS_HOST", "home.example.com"),
 		DefaultPort:  getEnv("DEFAULT_PORT", "38333"),
+		HTTPSPort:    getEnv("HTTPS_PORT", "443"),
 		SyncInterval: time.Duration(getEnvAsInt("SYNC_INTERVAL_SEC", 30)) * time.Second,
+		SyncWorkers:  getEnvAsInt("SYNC_WORKERS", 4),
+
+		BaotaReadyTimeout: time.Duration(getEnvAsInt("BAOTA_READY_TIMEOUT_SEC", 30)) * time.Second,
+		UpstreamCABundle:  getEnv("UPSTREAM_CA_BUNDLE", "/etc/pki/tls/certs/ca-bundle.crt"),
+
+		NginxResolver:      getEnv("NGINX_RESOLVER", ""),
+		DDNSReloadOnChange: getEnv("DDNS_RELOAD_ON_CHANGE", "true") == "true",
+		DDNSWatchInterval:  time.Duration(getEnvAsInt("DDNS_WATCH_INTERVAL_SEC", 60)) * time.Second,
+
+		ProbeEnabled:      getEnv("E2E_PROBE", "false") == "true",
+		ProbeAddr:         getEnv("PROBE_ADDR", ""),
+		ProbeDNSServer:    getEnv("PROBE_DNS_SERVER", ""),
+		ProbePath:         getEnv("PROBE_PATH", "/"),
+		ProbeTimeout:      time.Duration(getEnvAsInt("PROBE_TIMEOUT_SEC", 10)) * time.Second,
+		ProbeExpectStatus: getEnvAsInt("PROBE_EXPECT_STATUS", 0),
+		ProbeExpectBody:   getEnv("PROBE_EXPECT_BODY", ""),
+
+		DNSProvider:     getEnv("DNS_PROVIDER", ""),
+		DNSRecordTarget: getEnv("DNS_RECORD_TARGET", ""),
+		DNSTTL:          getEnvAsInt("DNS_TTL", 300),
+		DNSOwnerID:      getEnv("DNS_OWNER_ID", "kube-bt-sync"),
+
+		DDNSUpdate:         getEnv("DDNS_UPDATE", "false") == "true",
+		DDNSIPSource:       getEnv("DDNS_IP_SOURCE", "https://api.ipify.org"),
+		DDNSUpdateInterval: time.Duration(getEnvAsInt("DDNS_UPDATE_INTERVAL_SEC", 300)) * time.Second,
+
+		RFC2136Server:        getEnv("RFC2136_SERVER", ""),
+		RFC2136Zone:          getEnv("RFC2136_ZONE", ""),
+		RFC2136TSIGKeyName:   getEnv("RFC2136_TSIG_KEY_NAME", ""),
+		RFC2136TSIGSecret:    getEnv("RFC2136_TSIG_SECRET", ""),
+		RFC2136TSIGAlgorithm: getEnv("RFC2136_TSIG_ALGORITHM", "hmac-sha256"),
+
+		MissingSitePolicy:        getEnv("MISSING_SITE_POLICY", MissingSitePolicyRecreate),
+		MissingSiteConfirmations: getEnvAsInt("MISSING_SITE_CONFIRMATIONS", 3),
+
+		DryRun: getEnv("DRY_RUN", "false") == "true",
+
+		PodNamespace:   getEnv("POD_NAMESPACE", detectNamespace()),
+		StateConfigMap: getEnv("STATE_CONFIGMAP", "kube-bt-sync-state"),
+
+		RevisionConfigMap: getEnv("REVISION_CONFIGMAP", "kube-bt-sync-revisions"),
+		RevisionLimit:     getEnvAsInt("REVISION_LIMIT", 20),
+
+		AuditConfigMap: getEnv("AUDIT_CONFIGMAP", "kube-bt-sync-audit"),
+		AuditLimit:     getEnvAsInt("AUDIT_LIMIT", 1000),
+
+		MetricsAddr: getEnv("METRICS_ADDR", ":9090"),
+
+		WatchNamespaces:  splitList(getEnv("WATCH_NAMESPACES", "")),
+		LabelSelector:    getEnv("INGRESS_LABEL_SELECTOR", ""),
+		IngressClass:     getEnv("INGRESS_CLASS", ""),
+		GatewayAPI:       getEnv("GATEWAY_API", "auto"),
+		GatewayName:      getEnv("GATEWAY_NAME", ""),
+		GatewayNamespace: getEnv("GATEWAY_NAMESPACE", ""),
+
+		LeaderElection:   getEnv("LEADER_ELECTION", "true") == "true",
+		LeaderElectionID: getEnv("LEADER_ELECTION_ID", "kube-bt-sync-leader"),
+		PodName:          getEnv("POD_NAME", hostname()),
+	}
+
+	switch cfg.MissingSitePolicy {
+	case MissingSitePolicyRecreate, MissingSitePolicyReport, MissingSitePolicyDeleteIngress:
+	default:
+		slog.Warn("MISSING_SITE_POLICY 无效，回退为默认策略", "value", cfg.MissingSitePolicy, "fallback", MissingSitePolicyRecreate)
+		cfg.MissingSitePolicy = MissingSitePolicyRecreate
+	}
+	if cfg.SyncWorkers < 1 {
+		cfg.SyncWorkers = 1
+	}
+	if !strings.HasPrefix(cfg.ProbePath, "/") {
+		cfg.ProbePath = "/" + cfg.ProbePath
+	}
+	if cfg.DDNSWatchInterval < 10*time.Second {
+		cfg.DDNSWatchInterval = 10 * time.Second
+	}
+	if cfg.DDNSUpdateInterval < 30*time.Second {
+		cfg.DDNSUpdateInterval = 30 * time.Second
+	}
+	if cfg.DNSTTL < 1 {
+		cfg.DNSTTL = 300
+	}
+	if cfg.RevisionLimit < 1 {
+		cfg.RevisionLimit = 20
+	}
+	if cfg.AuditLimit < 1 {
+		cfg.AuditLimit = 1000
+	}
+	if cfg.MissingSiteConfirmations < 1 {
+		cfg.MissingSiteConfirmations = 1
+	}
+	if _, err := labels.Parse(cfg.LabelSelector); err != nil {
+		fatal("INGRESS_LABEL_SELECTOR 格式错误", "value", cfg.LabelSelector, "error", err)
+	}
+	if len(cfg.WatchNamespaces) > 0 || cfg.LabelSelector != "" || cfg.IngressClass != "" || cfg.GatewayName != "" {
+		slog.Info("管理范围", "namespaces", cfg.WatchNamespaces, "labelSelector", cfg.LabelSelector, "ingressClass", cfg.IngressClass, "gateway", cfg.GatewayName)
+	}
+	if cfg.DryRun {
+		slog.Warn("DRY_RUN 已开启：同步引擎只记录计划，不会修改宝塔与 Ingress")
+	}
+	return cfg
+}
+
+// detectNamespace 集群内运行时从 ServiceAccount 挂载目录读取当前命名空间
+func detectNamespace() string {
+	if data, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace"); err == nil {
+		if ns := strings.TrimSpace(string(data)); ns != "" {
+			return ns
+		}
+	}
+	return "default"
+}
+
+// splitList 解析逗号分隔的环境变量，忽略空白项
+func splitList(value string) []string {
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+func hostname() string {
+	if name, err := os.Hostname(); err == nil {
+		return name
 	}
+	return "kube-bt-sync"
 }
 
 func getEnv(key, fallback string) string {
@@ -0,0 +1,217 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 内置 DDNS 更新器：探测家庭宽带的公网 IP，通过 DNS 服务商把 DDNS_HOST 指向它
+// 程序运行在家庭集群内，出口 IP 就是宽带的公网 IP
+
+// DDNS_IP_SOURCE 使用网卡地址时的前缀，例如 iface:pppoe-wan
+const ddnsInterfacePrefix = "iface:"
+
+// DDNSUpdaterStatus 更新器最近一次的运行结果，展示在控制台的"家庭边缘节点"卡片上
+type DDNSUpdaterStatus struct {
+	Enabled    bool   `json:"enabled"`
+	Source     string `json:"source"`
+	IP         string `json:"ip,omitempty"`
+	LastCheck  string `json:"lastCheck,omitempty"`
+	LastUpdate string `json:"lastUpdate,omitempty"` // 最近一次真正写入 DNS 的时间
+	Error      string `json:"error,omitempty"`
+}
+
+var ddnsStatus DDNSUpdaterStatus
+var ddnsMutex sync.RWMutex
+
+// ddnsHostname DDNS_HOST 中的主机名部分 (兼容误填的协议头与端口)
+func ddnsHostname(cfg Config) string {
+	return strings.Split(strings.TrimPrefix(strings.TrimPrefix(cfg.DDNSHost, "http://"), "https://"), ":")[0]
+}
+
+// StartDDNSUpdater 周期性探测公网 IP，变化时更新 DDNS_HOST 的记录 (未开启 DDNS_UPDATE 时不做任何事)
+func StartDDNSUpdater(cfg Config) {
+	if !cfg.DDNSUpdate {
+		return
+	}
+	if dnsProvider == nil {
+		slog.Warn("DDNS_UPDATE=true 但未配置 DNS_PROVIDER，DDNS 更新器未启动")
+		ddnsMutex.Lock()
+		ddnsStatus = DDNSUpdaterStatus{Enabled: true, Source: cfg.DDNSIPSource, Error: "未配置 DNS_PROVIDER"}
+		ddnsMutex.Unlock()
+		return
+	}
+	slog.Info("DDNS 更新器已启动", "source", cfg.DDNSIPSource, "host", ddnsHostname(cfg), "interval", cfg.DDNSUpdateInterval)
+	for {
+		updateDDNSOnce(cfg)
+		<-time.After(cfg.DDNSUpdateInterval)
+	}
+}
+
+// updateDDNSOnce 探测一次公网 IP；与上次写入的 IP 相同时不调用 DNS 服务商
+func updateDDNSOnce(cfg Config) {
+	ddnsMutex.RLock()
+	st := ddnsStatus
+	ddnsMutex.RUnlock()
+	st.Enabled, st.Source = true, cfg.DDNSIPSource
+	st.LastCheck = time.Now().Format("2006-01-02 15:04:05")
+
+	ip, err := detectPublicIP(cfg)
+	if err == nil && (ip.String() != st.IP || st.Error != "") {
+		// DDNS_HOST 的记录通常是事先手工创建的，开启更新器即视为交给本工具维护
+		rec := DNSRecord{Name: ddnsHostname(cfg), Type: "A", Value: ip.String(), TTL: cfg.DNSTTL, Adopt: true}
+		if ip.To4() == nil {
+			rec.Type = "AAAA"
+		}
+		err = dnsProvider.Upsert(rec)
+		recordAudit(AuditActorController, AuditActionDNSUpsert, rec.Name, "DDNS 更新器: "+dnsProvider.Name(), st.IP, rec.Value, err)
+		if err == nil {
+			slog.Info("家庭公网 IP 变更", "host", rec.Name, "action", "ddns", "from", orNone(st.IP), "to", rec.Value)
+			recordHistoryNote(rec.Name, "ddns-updater", "ddns", fmt.Sprintf("已更新为 %s %s", rec.Type, rec.Value))
+			st.IP, st.LastUpdate = rec.Value, st.LastCheck
+		} else {
+			recordHistory(rec.Name, "ddns-updater", "ddns", err)
+		}
+	}
+
+	st.Error = ""
+	if err != nil {
+		st.Error = err.Error()
+		slog.Warn("DDNS 更新失败", "host", ddnsHostname(cfg), "action", "ddns", "error", err)
+	}
+	ddnsMutex.Lock()
+	ddnsStatus = st
+	ddnsMutex.Unlock()
+}
+
+// detectPublicIP 按 DDNS_IP_SOURCE 探测公网 IP：iface:<网卡名> 读取网卡上的公网地址，否则请求 IP 回显服务
+func detectPublicIP(cfg Config) (net.IP, error) {
+	if name, ok := strings.CutPrefix(cfg.DDNSIPSource, ddnsInterfacePrefix); ok {
+		iface, err := net.InterfaceByName(name)
+		if err != nil {
+			return nil, fmt.Errorf("读取网卡 %s 失败: %w", name, err)
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, fmt.Errorf("读取网卡 %s 的地址失败: %w", name, err)
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil && ipNet.IP.IsGlobalUnicast() && !ipNet.IP.IsPrivate() {
+				return ipNet.IP, nil
+			}
+		}
+		return nil, fmt.Errorf("网卡 %s 上没有公网 IPv4 地址", name)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", cfg.DDNSIPSource, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求 IP 回显服务失败: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+	ip := net.ParseIP(strings.TrimSpace(string(body)))
+	if resp.StatusCode != http.StatusOK || ip == nil {
+		return nil, fmt.Errorf("IP 回显服务返回了无法识别的内容 (HTTP %d): %.64s", resp.StatusCode, body)
+	}
+	return ip, nil
+}
+
+// 最近一次观察到的 DDNS 域名解析结果 (排序后拼接)，用于发现 IP 变化
+var lastDDNSIPs string
+
+// StartDDNSWatch 宝塔 Nginx 只在重载时解析一次 proxy_pass 中的域名：未配置 NGINX_RESOLVER 时，
+// 周期性解析 DDNS 域名，IP 变化后重载宝塔 Nginx，避免所有站点一直指向旧 IP
+func StartDDNSWatch(cfg Config) {
+	if cfg.NginxResolver != "" || !cfg.DDNSReloadOnChange {
+		return
+	}
+	slog.Info("DDNS 解析监测已启动，IP 变化后将重载宝塔 Nginx", "host", ddnsHostname(cfg), "interval", cfg.DDNSWatchInterval)
+	for {
+		if ips, err := net.LookupIP(ddnsHostname(cfg)); err == nil {
+			observeDDNSIPs(cfg, ips)
+		}
+		<-time.After(cfg.DDNSWatchInterval)
+	}
+}
+
+// observeDDNSIPs 记录 DDNS 域名的最新解析结果 (系统检测中的解析结果也会汇报到这里)
+// 与上一次不同时重载宝塔 Nginx；首次观察只做记录。只有 Leader 会执行重载
+func observeDDNSIPs(cfg Config, ips []net.IP) {
+	if cfg.NginxResolver != "" || !cfg.DDNSReloadOnChange || !IsLeader() || len(ips) == 0 {
+		return
+	}
+	var list []string
+	for _, ip := range ips {
+		list = append(list, ip.String())
+	}
+	sort.Strings(list)
+	current := strings.Join(list, ",")
+
+	ddnsMutex.Lock()
+	previous := lastDDNSIPs
+	lastDDNSIPs = current
+	ddnsMutex.Unlock()
+	if previous == "" || previous == current {
+		return
+	}
+
+	host := ddnsHostname(cfg)
+	if cfg.DryRun {
+		slog.Info("[dry-run] 解析结果变化，将重载宝塔 Nginx", "host", host, "action", "nginx-reload", "from", previous, "to", current)
+		return
+	}
+	unlock := lockPanel(cfg, host)
+	err := reloadBaotaNginx(cfg)
+	unlock()
+	updateProgress(host, "")
+	if err != nil {
+		slog.Error("解析结果变化后重载宝塔 Nginx 失败", "host", host, "action", "nginx-reload", "error", err)
+		// 恢复为旧的解析结果，下一轮重新尝试
+		ddnsMutex.Lock()
+		lastDDNSIPs = previous
+		ddnsMutex.Unlock()
+	} else {
+		slog.Info("解析结果变化，已重载宝塔 Nginx", "host", host, "action", "nginx-reload", "from", previous, "to", current)
+	}
+	recordHistory(host, "ddns-watch", "nginx-reload", err)
+	recordAudit(AuditActorController, AuditActionNginxReload, cfg.BaotaURL, "DDNS 域名 "+host+" 的解析结果变化", previous, current, err)
+}
+
+// ddnsFollowMode 宝塔 Nginx 跟随 DDNS IP 变化的方式，展示在控制台上
+func ddnsFollowMode(cfg Config) string {
+	switch {
+	case cfg.NginxResolver != "":
+		return "resolver " + cfg.NginxResolver
+	case cfg.DDNSReloadOnChange:
+		return "IP 变化时重载 Nginx"
+	}
+	return "未开启"
+}
+
+// GetDDNSUpdaterStatus 返回 DDNS 更新器最近一次的运行结果
+func GetDDNSUpdaterStatus() DDNSUpdaterStatus {
+	ddnsMutex.RLock()
+	defer ddnsMutex.RUnlock()
+	return ddnsStatus
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "无"
+	}
+	return s
+}
@@ -0,0 +1,197 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DNS 记录自动化：域名同步到宝塔后，自动创建指向宝塔服务器的公网记录，删除策略清理宝塔端时一并移除
+
+const DNSProviderRFC2136 = "rfc2136"
+
+// 归属标记：本工具创建的记录旁边会写入一条 <前缀><域名> 的 TXT 记录，只替换 / 删除带有本实例标记的记录
+const dnsOwnerPrefix = "_kube-bt-sync."
+
+// dnsOwnerName 归属标记的记录名：通配符只能是最左侧的标签，*.example.com 的标记写为 _kube-bt-sync._wildcard.example.com
+func dnsOwnerName(name string) string {
+	if rest, ok := strings.CutPrefix(name, "*."); ok {
+		return dnsOwnerPrefix + "_wildcard." + rest
+	}
+	return dnsOwnerPrefix + name
+}
+
+// errDNSNotOwned 同名记录已存在，但不是由本实例创建的
+var errDNSNotOwned = errors.New("同名记录不是由本实例创建的 (缺少归属标记)，拒绝修改")
+
+// dnsOwnerMarker 归属标记 TXT 记录的内容，多个实例共用一个区域时用 DNS_OWNER_ID 区分
+func dnsOwnerMarker(cfg Config) string {
+	return "heritage=kube-bt-sync,owner=" + cfg.DNSOwnerID
+}
+
+// DNSRecord 一条由本工具维护的记录，同名的 A / AAAA / CNAME 记录会被整体替换
+type DNSRecord struct {
+	Name  string
+	Type  string // A / AAAA / CNAME
+	Value string
+	TTL   int
+	Adopt bool // 同名记录不属于本实例时直接接管 (仅用于用户显式交给本工具维护的 DDNS_HOST)
+}
+
+func (r DNSRecord) String() string {
+	return fmt.Sprintf("%s %s", r.Type, r.Value)
+}
+
+// DNSProvider 可插拔的 DNS 服务商，新增服务商只需实现该接口并在 InitDNSProvider 中注册
+type DNSProvider interface {
+	Name() string
+	// Upsert 创建或替换记录 (先删除同名的 A / AAAA / CNAME，再写入新记录)
+	// 同名记录已存在且不属于本实例时返回 errDNSNotOwned (rec.Adopt 除外)
+	Upsert(rec DNSRecord) error
+	// Delete 删除本实例创建的同名 A / AAAA / CNAME 记录，记录不存在视为成功，不属于本实例时返回 errDNSNotOwned
+	Delete(name string) error
+}
+
+// DNSStatus 域名最近一次 DNS 操作的结果，展示在控制台上
+type DNSStatus struct {
+	Provider string `json:"provider"`
+	Record   string `json:"record"`
+	Time     string `json:"time"`
+	Synced   bool   `json:"synced"`
+	Error    string `json:"error,omitempty"`
+}
+
+var dnsProvider DNSProvider
+var dnsStatuses = make(map[string]DNSStatus)
+var dnsMutex sync.RWMutex
+
+// InitDNSProvider 按 DNS_PROVIDER 初始化 DNS 服务商，配置错误时直接退出 (与其静默不创建记录，不如尽早暴露)
+func InitDNSProvider(cfg Config) {
+	switch cfg.DNSProvider {
+	case "":
+		return
+	case DNSProviderRFC2136:
+		provider, err := newRFC2136Provider(cfg)
+		if err != nil {
+			fatal("DNS_PROVIDER 配置错误", "provider", cfg.DNSProvider, "error", err)
+		}
+		dnsProvider = provider
+	default:
+		fatal("DNS_PROVIDER 无效，只支持 "+DNSProviderRFC2136, "provider", cfg.DNSProvider)
+	}
+	slog.Info("已启用 DNS 记录自动化", "provider", dnsProvider.Name())
+}
+
+// dnsRecordFor 计算域名应当指向的记录：DNS_RECORD_TARGET 为 IP 时生成 A / AAAA，为域名时生成 CNAME
+func dnsRecordFor(cfg Config, host string) (DNSRecord, error) {
+	target := cfg.DNSRecordTarget
+	if target == "" {
+		u, err := url.Parse(cfg.BaotaURL)
+		if err != nil || u.Hostname() == "" {
+			return DNSRecord{}, fmt.Errorf("无法从 BAOTA_URL 推断宝塔服务器地址，请配置 DNS_RECORD_TARGET")
+		}
+		target = u.Hostname()
+	}
+	rec := DNSRecord{Name: host, Value: target, TTL: cfg.DNSTTL}
+	switch ip := net.ParseIP(target); {
+	case ip == nil:
+		rec.Type = "CNAME"
+	case ip.To4() != nil:
+		rec.Type = "A"
+	default:
+		rec.Type = "AAAA"
+	}
+	return rec, nil
+}
+
+// ensureDNSRecord 域名同步成功后确保公网记录存在；已成功写入相同记录时不重复调用服务商
+// DNS 失败不影响宝塔端的同步结果，只记录在状态与同步历史中，下次对账时重试
+func ensureDNSRecord(cfg Config, host, owner string) {
+	if dnsProvider == nil {
+		return
+	}
+	rec, err := dnsRecordFor(cfg, host)
+	if err == nil {
+		dnsMutex.RLock()
+		st, ok := dnsStatuses[host]
+		dnsMutex.RUnlock()
+		if ok && st.Synced && st.Record == rec.String() {
+			return
+		}
+		// 不属于本实例的记录不会自行改变归属，避免每轮对账都重复请求与审计 (重启或记录内容变化后再尝试)
+		if ok && st.Record == rec.String() && st.Error == errDNSNotOwned.Error() {
+			return
+		}
+		err = dnsProvider.Upsert(rec)
+		recordAudit(AuditActorController, AuditActionDNSUpsert, host, dnsProvider.Name(), st.Record, rec.String(), err)
+	}
+
+	setDNSStatus(host, rec.String(), err)
+	if err != nil {
+		slog.Warn("写入 DNS 记录失败", "host", host, "action", "dns", "error", err)
+		recordHistory(host, owner, "dns", err)
+		return
+	}
+	slog.Info("DNS 记录已更新", "host", host, "action", "dns", "record", rec.String())
+	recordHistoryNote(host, owner, "dns", "已写入 DNS 记录 "+rec.String())
+}
+
+// removeDNSRecord 删除策略清理宝塔端后移除公网记录
+// 失败只记录在同步历史中，不阻塞 Ingress 的删除 (残留的记录指向的宝塔站点已不存在)
+func removeDNSRecord(host, owner string) {
+	if dnsProvider == nil {
+		return
+	}
+	err := dnsProvider.Delete(host)
+	recordAuditNow(AuditActorController, AuditActionDNSDelete, host, dnsProvider.Name(), "", "", err)
+	if errors.Is(err, errDNSNotOwned) {
+		slog.Warn("DNS 记录不是由本实例创建的，已跳过删除", "host", host, "action", "dns-delete")
+		dnsMutex.Lock()
+		delete(dnsStatuses, host)
+		dnsMutex.Unlock()
+		recordHistoryNote(host, owner, "dns-delete", "同名记录不是由本实例创建的，未删除")
+		return
+	}
+	if err != nil {
+		slog.Warn("删除 DNS 记录失败", "host", host, "action", "dns-delete", "error", err)
+		setDNSStatus(host, "", err)
+		recordHistory(host, owner, "dns-delete", err)
+		return
+	}
+	dnsMutex.Lock()
+	delete(dnsStatuses, host)
+	dnsMutex.Unlock()
+	slog.Info("DNS 记录已删除", "host", host, "action", "dns-delete")
+	recordHistory(host, owner, "dns-delete", nil)
+}
+
+func setDNSStatus(host, record string, err error) {
+	st := DNSStatus{Provider: dnsProvider.Name(), Record: record, Time: time.Now().Format("2006-01-02 15:04:05"), Synced: err == nil}
+	if err != nil {
+		st.Error = err.Error()
+	}
+	dnsMutex.Lock()
+	dnsStatuses[host] = st
+	dnsMutex.Unlock()
+}
+
+// GetDNSStatus 返回域名最近一次的 DNS 操作结果 (未启用 DNS 自动化时 ok=false)
+func GetDNSStatus(host string) (DNSStatus, bool) {
+	dnsMutex.RLock()
+	defer dnsMutex.RUnlock()
+	st, ok := dnsStatuses[host]
+	return st, ok
+}
+
+// DNSProviderName 当前启用的 DNS 服务商，未启用时为空
+func DNSProviderName() string {
+	if dnsProvider == nil {
+		return ""
+	}
+	return dnsProvider.Name()
+}
@@ -0,0 +1,77 @@
+package internal
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// detectProxyDrift 对比宝塔端实时反代配置与已同步记录，返回差异描述 (为空表示没有漂移)
+func detectProxyDrift(cfg Config, host string, record SyncRecord) ([]string, error) {
+	proxy, err := getBaotaProxy(cfg, host)
+	if err != nil {
+		return nil, err
+	}
+	if proxy == nil {
+		return []string{"反代规则 " + ProxyName + " 已被删除"}, nil
+	}
+
+	var changes []string
+	if strings.TrimRight(proxy.ProxySite, "/") != strings.TrimRight(record.TargetURL, "/") {
+		changes = append(changes, fmt.Sprintf("反代目标被改为 %s (期望 %s)", proxy.ProxySite, record.TargetURL))
+	}
+	if proxy.ProxyDir != "/" {
+		changes = append(changes, fmt.Sprintf("代理目录被改为 %s (期望 /)", proxy.ProxyDir))
+	}
+	if proxy.ToDomain != "$host" {
+		changes = append(changes, fmt.Sprintf("发送域名被改为 %s (期望 $host)", proxy.ToDomain))
+	}
+	if !proxy.Enabled() {
+		changes = append(changes, "反代规则被停用")
+	}
+	return changes, nil
+}
+
+// checkDrift 全量对账时逐个拉取已同步域名的宝塔反代配置，发现手动改动则记录到同步历史并重新入队修复
+func checkDrift(cfg Config, domains map[string]bool) {
+	cacheMutex.RLock()
+	records := make(map[string]SyncRecord, len(syncedCache))
+	for host, record := range syncedCache {
+		if domains[host] {
+			records[host] = record
+		}
+	}
+	cacheMutex.RUnlock()
+
+	for host, record := range records {
+		if IsSyncInProgress(host) {
+			continue
+		}
+		changes, err := detectProxyDrift(cfg, host, record)
+		if err != nil {
+			slog.Warn("漂移检测跳过", "host", host, "action", "drift", "error", err)
+			continue
+		}
+		if len(changes) == 0 {
+			continue
+		}
+
+		msg := strings.Join(changes, "；")
+		if cfg.DryRun {
+			slog.Info("[dry-run] 检测到宝塔端配置漂移，将重新下发", "host", host, "action", "drift", "detail", msg)
+			recordHistoryNote(host, record.Namespace+"/"+record.Ingress, "dry-run", "将执行: update (修复漂移: "+msg+")")
+			continue
+		}
+		slog.Warn("检测到宝塔端配置漂移，已加入修复队列", "host", host, "action", "drift", "detail", msg)
+		recordHistoryNote(host, record.Namespace+"/"+record.Ingress, "drift", msg)
+
+		// 清空配置指纹即可让消费者重新下发，归属与删除策略保持不变
+		cacheMutex.Lock()
+		if current, ok := syncedCache[host]; ok {
+			current.ConfigHash = ""
+			syncedCache[host] = current
+		}
+		cacheMutex.Unlock()
+		syncQueue.Add(host)
+	}
+}
@@ -0,0 +1,410 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// EdgeRoute 是本工具自带的 CRD：用结构化的字段代替注解声明一个对外域名，同步结果写回 status 子资源
+const KindEdgeRoute = "EdgeRoute"
+
+const edgeRouteGroupVersion = "kube-bt-sync.io/v1alpha1"
+
+// edgeRouteResource 集群中已安装 EdgeRoute CRD 时才会被赋值
+var edgeRouteResource schema.GroupVersionResource
+
+// routeConfigErrorAnnotation 转换 EdgeRoute 时发现的字段错误，只存在于内存中的 Ingress 形式上，不会写回集群
+const routeConfigErrorAnnotation = "kube-bt-sync.io/internal-config-error"
+
+// 由 EdgeRoute 的 backend.service 生成的路由 Ingress 上的标签
+const edgeRouteLabel = "kube-bt-sync.io/edge-route"
+
+// edgeRoute EdgeRoute 的完整结构，字段与 charts/kube-bt-sync/crds 中的 CRD 一致
+type edgeRoute struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              struct {
+		Host    string `json:"host"`
+		Backend struct {
+			Service *struct {
+				Name string             `json:"name"`
+				Port intstr.IntOrString `json:"port"`
+			} `json:"service"`
+			IngressRef *struct {
+				Name string `json:"name"`
+			} `json:"ingressRef"`
+		} `json:"backend"`
+		DDNSPort int `json:"ddnsPort"`
+		Upstream struct {
+			Host      string `json:"host"`
+			Scheme    string `json:"scheme"`
+			VerifyTLS bool   `json:"verifyTLS"`
+		} `json:"upstream"`
+		SSLMode string `json:"sslMode"`
+		Access  struct {
+			Allow []string `json:"allow"`
+			Deny  []string `json:"deny"`
+		} `json:"access"`
+		DeletionPolicy string `json:"deletionPolicy"`
+	} `json:"spec"`
+	Status edgeRouteStatus `json:"status"`
+}
+
+// edgeRouteStatus EdgeRoute 的 status 子资源
+type edgeRouteStatus struct {
+	Phase              string `json:"phase,omitempty"`
+	Target             string `json:"target,omitempty"`
+	LastSyncTime       string `json:"lastSyncTime,omitempty"`
+	Error              string `json:"error,omitempty"`
+	ObservedGeneration int64  `json:"observedGeneration,omitempty"`
+	RoutingIngress     string `json:"routingIngress,omitempty"`
+}
+
+// DetectEdgeRoute 通过 discovery 检测集群是否安装了 EdgeRoute CRD，未安装时只同步 Ingress / HTTPRoute
+func DetectEdgeRoute(clientset *kubernetes.Clientset) {
+	resources, err := clientset.Discovery().ServerResourcesForGroupVersion(edgeRouteGroupVersion)
+	if err != nil {
+		slog.Info("集群未安装 EdgeRoute CRD，跳过 EdgeRoute 同步", "version", edgeRouteGroupVersion)
+		return
+	}
+	for _, r := range resources.APIResources {
+		if r.Name == "edgeroutes" {
+			gv, _ := schema.ParseGroupVersion(edgeRouteGroupVersion)
+			edgeRouteResource = gv.WithResource("edgeroutes")
+			slog.Info("检测到 EdgeRoute CRD，EdgeRoute 将与 Ingress 一起同步", "version", edgeRouteGroupVersion)
+			return
+		}
+	}
+}
+
+func edgeRoutesEnabled() bool {
+	return edgeRouteResource.Resource != "" && dynamicClient != nil
+}
+
+func edgeRoutes(namespace string) dynamic.ResourceInterface {
+	return dynamicClient.Resource(edgeRouteResource).Namespace(namespace)
+}
+
+// edgeRouteIngressName backend.service 生成的路由 Ingress 名称
+func edgeRouteIngressName(name string) string {
+	return name + "-bt-edge"
+}
+
+// listEdgeRoutes 按管理范围列出 EdgeRoute，转换为 Ingress 形式，并检查 backend.ingressRef 引用的 Ingress
+func listEdgeRoutes(clientset *kubernetes.Clientset, cfg Config) ([]networkingv1.Ingress, error) {
+	if !edgeRoutesEnabled() {
+		return nil, nil
+	}
+	var items []networkingv1.Ingress
+	for _, ns := range scopedNamespaces(cfg) {
+		list, err := edgeRoutes(ns).List(context.TODO(), metav1.ListOptions{LabelSelector: cfg.LabelSelector})
+		if err != nil {
+			return nil, fmt.Errorf("获取 EdgeRoute 列表失败: %w", err)
+		}
+		for i := range list.Items {
+			u := &list.Items[i]
+			ing, err := edgeRouteToIngress(u)
+			if err != nil {
+				slog.Warn("解析 EdgeRoute 失败", "kind", KindEdgeRoute, "namespace", u.GetNamespace(), "ingress", u.GetName(), "error", err)
+				continue
+			}
+			if ref, _, _ := unstructured.NestedString(u.Object, "spec", "backend", "ingressRef", "name"); ref != "" && ing.Annotations[routeConfigErrorAnnotation] == "" {
+				if err := checkIngressRef(clientset, u.GetNamespace(), ref, ing.Spec.Rules[0].Host); err != nil {
+					ing.Annotations[routeConfigErrorAnnotation] = err.Error()
+				}
+			}
+			items = append(items, ing)
+		}
+	}
+	return items, nil
+}
+
+// checkIngressRef backend.ingressRef 引用的 Ingress 必须存在，并且声明了同一个域名
+func checkIngressRef(clientset *kubernetes.Clientset, namespace, name, host string) error {
+	ref, err := clientset.NetworkingV1().Ingresses(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return fmt.Errorf("spec.backend.ingressRef 引用的 Ingress %s 不存在", name)
+	}
+	if err != nil {
+		return fmt.Errorf("读取 spec.backend.ingressRef 引用的 Ingress %s 失败: %w", name, err)
+	}
+	if !declaresHost(*ref, host) {
+		return fmt.Errorf("spec.backend.ingressRef 引用的 Ingress %s 没有声明域名 %s", name, host)
+	}
+	return nil
+}
+
+// edgeRouteToIngress 把 EdgeRoute 的字段转换为同步引擎已经支持的注解，status 转换为同步状态注解，Kind 标记为 EdgeRoute
+// 字段错误不会让转换失败，而是记录在 routeConfigErrorAnnotation 中，由同步引擎写回 status
+func edgeRouteToIngress(u *unstructured.Unstructured) (networkingv1.Ingress, error) {
+	var route edgeRoute
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &route); err != nil {
+		return networkingv1.Ingress{}, err
+	}
+	spec := route.Spec
+
+	annotations := make(map[string]string)
+	for k, v := range route.Annotations {
+		annotations[k] = v
+	}
+	for _, key := range append(exposePassthroughAnnotations, routeConfigErrorAnnotation, syncPhaseAnnotation, syncStatusAnnotation) {
+		delete(annotations, key)
+	}
+	annotations["kube-bt-sync.io/baota-sync"] = "true"
+	if spec.DDNSPort != 0 {
+		annotations[upstreamPortAnnotation] = strconv.Itoa(spec.DDNSPort)
+	}
+	if spec.Upstream.Host != "" {
+		annotations[upstreamHostAnnotation] = spec.Upstream.Host
+	}
+	if spec.Upstream.Scheme != "" {
+		annotations[upstreamSchemeAnnotation] = spec.Upstream.Scheme
+	}
+	if spec.Upstream.VerifyTLS {
+		annotations[upstreamVerifyTLSAnnotation] = "true"
+	}
+	if spec.SSLMode != "" {
+		annotations[sslModeAnnotation] = spec.SSLMode
+	}
+	if len(spec.Access.Allow) > 0 {
+		annotations[allowIPsAnnotation] = strings.Join(spec.Access.Allow, ",")
+	}
+	if len(spec.Access.Deny) > 0 {
+		annotations[denyIPsAnnotation] = strings.Join(spec.Access.Deny, ",")
+	}
+	if spec.DeletionPolicy != "" {
+		annotations["kube-bt-sync.io/deletion-policy"] = spec.DeletionPolicy
+	}
+	if err := validateEdgeRouteSpec(route); err != nil {
+		annotations[routeConfigErrorAnnotation] = err.Error()
+	}
+	if st := route.Status; st.Phase != "" {
+		raw, _ := json.Marshal(map[string]HostSyncStatus{spec.Host: {Phase: st.Phase, Target: st.Target, LastSyncTime: st.LastSyncTime, Error: st.Error}})
+		annotations[syncPhaseAnnotation] = st.Phase
+		annotations[syncStatusAnnotation] = string(raw)
+	}
+
+	ing := networkingv1.Ingress{
+		TypeMeta:   metav1.TypeMeta{Kind: KindEdgeRoute, APIVersion: u.GetAPIVersion()},
+		ObjectMeta: route.ObjectMeta,
+	}
+	ing.Annotations = annotations
+
+	pathType := networkingv1.PathTypePrefix
+	path := networkingv1.HTTPIngressPath{Path: "/", PathType: &pathType}
+	if svc := spec.Backend.Service; svc != nil {
+		path.Backend.Service = &networkingv1.IngressServiceBackend{Name: svc.Name, Port: servicePortFromIntOrString(svc.Port)}
+	}
+	ing.Spec.Rules = []networkingv1.IngressRule{{
+		Host:             spec.Host,
+		IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{Paths: []networkingv1.HTTPIngressPath{path}}},
+	}}
+	return ing, nil
+}
+
+// validateEdgeRouteSpec 检查注解无法表达的字段约束 (注解本身的取值由 parseProxyOptions 校验)
+func validateEdgeRouteSpec(route edgeRoute) error {
+	spec := route.Spec
+	if spec.Host == "" {
+		return fmt.Errorf("spec.host 不能为空")
+	}
+	if errs := validation.IsDNS1123Subdomain(spec.Host); len(errs) > 0 {
+		if wildcardErrs := validation.IsWildcardDNS1123Subdomain(spec.Host); len(wildcardErrs) > 0 {
+			return fmt.Errorf("spec.host=%q 不是合法的域名", spec.Host)
+		}
+	}
+	svc, ref := spec.Backend.Service, spec.Backend.IngressRef
+	if (svc == nil) == (ref == nil) {
+		return fmt.Errorf("spec.backend 必须且只能填写 service 或 ingressRef 之一")
+	}
+	if svc != nil && (svc.Name == "" || (svc.Port.Type == intstr.Int && svc.Port.IntVal == 0) || (svc.Port.Type == intstr.String && svc.Port.StrVal == "")) {
+		return fmt.Errorf("spec.backend.service 必须填写 name 与 port")
+	}
+	if ref != nil && ref.Name == "" {
+		return fmt.Errorf("spec.backend.ingressRef.name 不能为空")
+	}
+	switch spec.DeletionPolicy {
+	case "", DeletionPolicyRetain, DeletionPolicyDeleteProxy, DeletionPolicyDeleteSite:
+	default:
+		return fmt.Errorf("spec.deletionPolicy=%q 无效", spec.DeletionPolicy)
+	}
+	return nil
+}
+
+func servicePortFromIntOrString(port intstr.IntOrString) networkingv1.ServiceBackendPort {
+	if port.Type == intstr.String {
+		return networkingv1.ServiceBackendPort{Name: port.StrVal}
+	}
+	return networkingv1.ServiceBackendPort{Number: port.IntVal}
+}
+
+// patchEdgeRouteStatus 把同步结果写入 EdgeRoute 的 status 子资源；内容无变化时不发起写请求
+// (写 status 不会改变 generation，因此不会引起对账循环)
+func patchEdgeRouteStatus(obj runtime.Object, status HostSyncStatus) (runtime.Object, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return obj, fmt.Errorf("EdgeRoute 对象类型异常: %T", obj)
+	}
+	var route edgeRoute
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &route); err != nil {
+		return obj, err
+	}
+
+	desired := edgeRouteStatus{
+		Phase: status.Phase, Target: status.Target, LastSyncTime: status.LastSyncTime, Error: status.Error,
+		ObservedGeneration: u.GetGeneration(),
+	}
+	if route.Spec.Backend.Service != nil {
+		desired.RoutingIngress = edgeRouteIngressName(u.GetName())
+	} else if route.Spec.Backend.IngressRef != nil {
+		desired.RoutingIngress = route.Spec.Backend.IngressRef.Name
+	}
+	if route.Status == desired {
+		return obj, nil
+	}
+
+	// merge patch 中为 null 的字段会被删除，用于清理上一次的错误信息
+	fields := map[string]interface{}{
+		"phase": desired.Phase, "target": desired.Target, "lastSyncTime": desired.LastSyncTime,
+		"observedGeneration": desired.ObservedGeneration, "error": nil, "routingIngress": nil,
+	}
+	if desired.Error != "" {
+		fields["error"] = desired.Error
+	}
+	if desired.RoutingIngress != "" {
+		fields["routingIngress"] = desired.RoutingIngress
+	}
+	patch, _ := json.Marshal(map[string]interface{}{"status": fields})
+	return edgeRoutes(u.GetNamespace()).Patch(context.TODO(), u.GetName(), types.MergePatchType, patch, metav1.PatchOptions{}, "status")
+}
+
+// watchEdgeRoutes 与 Ingress 监听器相同的事件处理，并维护 backend.service 生成的路由 Ingress
+func watchEdgeRoutes(k8sClient *kubernetes.Clientset, cfg Config, namespace string) {
+	for {
+		watcher, err := edgeRoutes(namespace).Watch(context.TODO(), metav1.ListOptions{LabelSelector: cfg.LabelSelector})
+		if err != nil {
+			slog.Error("监听 EdgeRoute 失败，5秒后重试", "kind", KindEdgeRoute, "namespace", namespace, "error", err)
+			watchReconnects.WithLabelValues("EdgeRoute", "error").Inc()
+			time.Sleep(5 * time.Second)
+			continue
+		}
+
+		TriggerSync(k8sClient, cfg)
+		if list, err := edgeRoutes(namespace).List(context.TODO(), metav1.ListOptions{LabelSelector: cfg.LabelSelector}); err == nil {
+			for i := range list.Items {
+				reconcileEdgeRouteBackend(k8sClient, cfg, &list.Items[i])
+			}
+		}
+
+		for event := range watcher.ResultChan() {
+			u, ok := event.Object.(*unstructured.Unstructured)
+			if !ok {
+				continue
+			}
+			invalidateRouteSnapshot()
+			if event.Type != "DELETED" {
+				reconcileEdgeRouteBackend(k8sClient, cfg, u)
+			}
+			route, err := edgeRouteToIngress(u)
+			if err != nil || !IsManagedIngress(cfg, &route) {
+				continue
+			}
+			slog.Info("路由事件，已加入同步队列", "kind", KindEdgeRoute, "namespace", route.Namespace, "ingress", route.Name, "event", event.Type)
+			EnqueueIngress(&route)
+		}
+
+		watchReconnects.WithLabelValues("EdgeRoute", "closed").Inc()
+		time.Sleep(2 * time.Second)
+	}
+}
+
+// reconcileEdgeRouteBackend backend.service 时生成 / 更新把域名路由到该 Service 的 Ingress，改为 ingressRef 时删除
+// (EdgeRoute 被删除时，生成的 Ingress 由 ownerReference 触发 K8s 垃圾回收)
+func reconcileEdgeRouteBackend(clientset *kubernetes.Clientset, cfg Config, u *unstructured.Unstructured) {
+	if u.GetDeletionTimestamp() != nil {
+		return
+	}
+	var route edgeRoute
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &route); err != nil {
+		return
+	}
+
+	name := edgeRouteIngressName(route.Name)
+	client := clientset.NetworkingV1().Ingresses(route.Namespace)
+	existing, err := client.Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		slog.Warn("读取 EdgeRoute 生成的 Ingress 失败", "kind", KindEdgeRoute, "namespace", route.Namespace, "ingress", route.Name, "error", err)
+		return
+	}
+	if err == nil && existing.Labels[managedByLabel] != managedByValue {
+		backendFailed(u, fmt.Errorf("同名 Ingress %s 已存在且不是由 kube-bt-sync 生成的", name))
+		return
+	}
+	if apierrors.IsNotFound(err) {
+		existing = nil
+	}
+
+	var desired *networkingv1.Ingress
+	if svc := route.Spec.Backend.Service; svc != nil && validateEdgeRouteSpec(route) == nil {
+		isController := true
+		desired = newRoutingIngress(cfg, name, route.Namespace, route.Spec.Host,
+			networkingv1.IngressServiceBackend{Name: svc.Name, Port: servicePortFromIntOrString(svc.Port)},
+			metav1.OwnerReference{APIVersion: u.GetAPIVersion(), Kind: KindEdgeRoute, Name: route.Name, UID: route.UID, Controller: &isController},
+			map[string]string{managedByLabel: managedByValue, edgeRouteLabel: route.Name}, nil)
+	}
+
+	switch {
+	case desired == nil && existing == nil:
+		return
+	case cfg.DryRun:
+		slog.Info("[dry-run] 将调整 EdgeRoute 生成的路由 Ingress", "kind", KindEdgeRoute, "namespace", route.Namespace, "ingress", route.Name, "generated", name)
+	case desired == nil:
+		if err := client.Delete(context.TODO(), name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			backendFailed(u, fmt.Errorf("删除路由 Ingress 失败: %w", err))
+			return
+		}
+		slog.Info("EdgeRoute 已不再使用 backend.service，已删除生成的 Ingress", "kind", KindEdgeRoute, "namespace", route.Namespace, "ingress", route.Name, "generated", name)
+	case existing == nil:
+		if _, err := client.Create(context.TODO(), desired, metav1.CreateOptions{}); err != nil {
+			backendFailed(u, fmt.Errorf("创建路由 Ingress 失败: %w", err))
+			return
+		}
+		slog.Info("EdgeRoute 已生成路由 Ingress", "kind", KindEdgeRoute, "namespace", route.Namespace, "ingress", route.Name, "generated", name)
+	default:
+		updated := mergeGeneratedIngress(existing, desired, nil)
+		if apiequality.Semantic.DeepEqual(existing, updated) {
+			return
+		}
+		if _, err := client.Update(context.TODO(), updated, metav1.UpdateOptions{}); err != nil {
+			backendFailed(u, fmt.Errorf("更新路由 Ingress 失败: %w", err))
+			return
+		}
+		slog.Info("EdgeRoute 已更新生成的路由 Ingress", "kind", KindEdgeRoute, "namespace", route.Namespace, "ingress", route.Name, "generated", name)
+	}
+}
+
+func backendFailed(u *unstructured.Unstructured, err error) {
+	slog.Warn("EdgeRoute 维护路由 Ingress 失败", "kind", KindEdgeRoute, "namespace", u.GetNamespace(), "ingress", u.GetName(), "error", err)
+	if eventRecorder != nil {
+		eventRecorder.Eventf(u, corev1.EventTypeWarning, "BackendFailed", "维护路由 Ingress 失败: %v", err)
+	}
+}
@@ -0,0 +1,301 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Service 上的快速暴露注解：填写域名后自动生成一个归属于该 Service 的 Ingress，去掉注解即连同 Ingress 一起回收
+const (
+	exposeHostAnnotation = "kube-bt-sync.io/expose-host"
+	exposePortAnnotation = "kube-bt-sync.io/expose-port" // 端口号或端口名，默认取 Service 的第一个端口
+)
+
+// 生成的 Ingress 上的标签，用于识别由本工具生成、可以随时重建或删除的 Ingress
+const (
+	managedByLabel      = "app.kubernetes.io/managed-by"
+	managedByValue      = "kube-bt-sync"
+	exposedServiceLabel = "kube-bt-sync.io/exposed-service"
+)
+
+// 从 Service 透传到生成的 Ingress 上的注解
+var exposePassthroughAnnotations = []string{
+	"kube-bt-sync.io/deletion-policy",
+	upstreamPortAnnotation,
+	upstreamHostAnnotation,
+	upstreamSchemeAnnotation,
+	upstreamVerifyTLSAnnotation,
+	sslModeAnnotation,
+	allowIPsAnnotation,
+	denyIPsAnnotation,
+}
+
+// exposedIngressName 生成的 Ingress 名称
+func exposedIngressName(serviceName string) string {
+	return serviceName + "-bt-expose"
+}
+
+// StartServiceWatcher 监听 Service 的快速暴露注解
+func StartServiceWatcher(k8sClient *kubernetes.Clientset, cfg Config) {
+	for _, ns := range scopedNamespaces(cfg) {
+		go watchServices(k8sClient, cfg, ns)
+	}
+}
+
+func watchServices(k8sClient *kubernetes.Clientset, cfg Config, namespace string) {
+	for {
+		watcher, err := k8sClient.CoreV1().Services(namespace).Watch(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			slog.Error("监听 Service 失败，5秒后重试", "namespace", namespace, "error", err)
+			watchReconnects.WithLabelValues("Service", "error").Inc()
+			time.Sleep(5 * time.Second)
+			continue
+		}
+
+		// 每次（重新）建立监听后全量对账一次，回收断线期间被去掉注解的 Service 所生成的 Ingress
+		reconcileExposedServices(k8sClient, cfg, namespace)
+
+		for event := range watcher.ResultChan() {
+			svc, ok := event.Object.(*corev1.Service)
+			if !ok || event.Type == "DELETED" {
+				// Service 被删除时，生成的 Ingress 由 ownerReference 触发 K8s 垃圾回收
+				continue
+			}
+			reconcileExposedService(k8sClient, cfg, svc)
+		}
+
+		watchReconnects.WithLabelValues("Service", "closed").Inc()
+		time.Sleep(2 * time.Second)
+	}
+}
+
+// reconcileExposedServices 对命名空间下的全部 Service 执行一次快速暴露对账
+func reconcileExposedServices(clientset *kubernetes.Clientset, cfg Config, namespace string) {
+	services, err := clientset.CoreV1().Services(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		slog.Warn("获取 Service 列表失败", "namespace", namespace, "error", err)
+		return
+	}
+	for i := range services.Items {
+		reconcileExposedService(clientset, cfg, &services.Items[i])
+	}
+}
+
+// reconcileExposedService 带注解时生成 / 更新 Ingress，注解被去掉时删除此前生成的 Ingress
+// (Ingress 的删除会按删除策略清理宝塔端，生成的 Ingress 默认策略为 delete-site)
+func reconcileExposedService(clientset *kubernetes.Clientset, cfg Config, svc *corev1.Service) {
+	name := exposedIngressName(svc.Name)
+	client := clientset.NetworkingV1().Ingresses(svc.Namespace)
+	existing, err := client.Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		slog.Warn("读取 Service 生成的 Ingress 失败", "namespace", svc.Namespace, "service", svc.Name, "error", err)
+		return
+	}
+	if err == nil && existing.Labels[managedByLabel] != managedByValue {
+		if svc.Annotations[exposeHostAnnotation] != "" {
+			exposeFailed(svc, fmt.Errorf("同名 Ingress %s 已存在且不是由 kube-bt-sync 生成的", name))
+		}
+		return
+	}
+	if apierrors.IsNotFound(err) {
+		existing = nil
+	}
+
+	if svc.Annotations[exposeHostAnnotation] == "" {
+		if existing == nil {
+			return
+		}
+		if cfg.DryRun {
+			slog.Info("[dry-run] Service 已去掉快速暴露注解，将删除生成的 Ingress", "namespace", svc.Namespace, "service", svc.Name, "ingress", name)
+			return
+		}
+		err := client.Delete(context.TODO(), name, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			slog.Error("删除 Service 生成的 Ingress 失败", "namespace", svc.Namespace, "service", svc.Name, "ingress", name, "error", err)
+			return
+		}
+		slog.Info("Service 已去掉快速暴露注解，已删除生成的 Ingress", "namespace", svc.Namespace, "service", svc.Name, "ingress", name)
+		return
+	}
+
+	desired, err := buildExposedIngress(cfg, svc)
+	if err != nil {
+		exposeFailed(svc, err)
+		return
+	}
+
+	if existing == nil {
+		if cfg.DryRun {
+			slog.Info("[dry-run] Service 将生成 Ingress", "namespace", svc.Namespace, "service", svc.Name, "ingress", name, "host", desired.Spec.Rules[0].Host)
+			return
+		}
+		if _, err := client.Create(context.TODO(), desired, metav1.CreateOptions{}); err != nil {
+			exposeFailed(svc, fmt.Errorf("创建 Ingress 失败: %w", err))
+			return
+		}
+		slog.Info("Service 已生成 Ingress", "namespace", svc.Namespace, "service", svc.Name, "ingress", name, "host", desired.Spec.Rules[0].Host)
+		if eventRecorder != nil {
+			eventRecorder.Eventf(svc, corev1.EventTypeNormal, "Exposed", "已生成 Ingress %s，域名 %s", name, desired.Spec.Rules[0].Host)
+		}
+		return
+	}
+
+	updated := mergeGeneratedIngress(existing, desired, exposePassthroughAnnotations)
+	if apiequality.Semantic.DeepEqual(existing, updated) {
+		return
+	}
+	if cfg.DryRun {
+		slog.Info("[dry-run] Service 将更新生成的 Ingress", "namespace", svc.Namespace, "service", svc.Name, "ingress", name)
+		return
+	}
+	if _, err := client.Update(context.TODO(), updated, metav1.UpdateOptions{}); err != nil {
+		exposeFailed(svc, fmt.Errorf("更新 Ingress 失败: %w", err))
+		return
+	}
+	slog.Info("Service 已更新生成的 Ingress", "namespace", svc.Namespace, "service", svc.Name, "ingress", name)
+}
+
+// buildExposedIngress 生成与控制台可视化向导一致的 Ingress (关闭强制 HTTPS 跳转，避免宝塔反代出现重定向循环)
+func buildExposedIngress(cfg Config, svc *corev1.Service) (*networkingv1.Ingress, error) {
+	host := svc.Annotations[exposeHostAnnotation]
+	if errs := validation.IsDNS1123Subdomain(host); len(errs) > 0 {
+		if wildcardErrs := validation.IsWildcardDNS1123Subdomain(host); len(wildcardErrs) > 0 {
+			return nil, fmt.Errorf("%s=%q 不是合法的域名", exposeHostAnnotation, host)
+		}
+	}
+
+	port, err := exposedServicePort(svc)
+	if err != nil {
+		return nil, err
+	}
+
+	annotations := map[string]string{
+		"kube-bt-sync.io/baota-sync":      "true",
+		"kube-bt-sync.io/deletion-policy": DeletionPolicyDeleteSite,
+	}
+	for _, key := range exposePassthroughAnnotations {
+		if v, ok := svc.Annotations[key]; ok && v != "" {
+			annotations[key] = v
+		}
+	}
+
+	isController := true
+	ing := newRoutingIngress(cfg, exposedIngressName(svc.Name), svc.Namespace, host,
+		networkingv1.IngressServiceBackend{Name: svc.Name, Port: port},
+		metav1.OwnerReference{APIVersion: "v1", Kind: "Service", Name: svc.Name, UID: svc.UID, Controller: &isController},
+		map[string]string{managedByLabel: managedByValue, exposedServiceLabel: svc.Name}, annotations)
+
+	// newRoutingIngress 已补齐标签选择器要求的标签，选择器无法推断标签时拒绝生成
+	if !ingressInScope(cfg, ing) {
+		return nil, fmt.Errorf("生成的 Ingress 不匹配标签选择器 %q", cfg.LabelSelector)
+	}
+	if _, _, _, err := parseProxyOptions(cfg, *ing); err != nil {
+		return nil, err
+	}
+	return ing, nil
+}
+
+// newRoutingIngress 生成把域名整体路由到某个 Service 端口的 Ingress，归属于 owner，随 owner 一起被垃圾回收
+// 标签选择器中的等值条件会补齐到标签上，保证生成的 Ingress 仍在本实例的管理范围内
+func newRoutingIngress(cfg Config, name, namespace, host string, backend networkingv1.IngressServiceBackend, owner metav1.OwnerReference, labels, annotations map[string]string) *networkingv1.Ingress {
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations["nginx.ingress.kubernetes.io/ssl-redirect"] = "false"
+
+	// 配置了 INGRESS_CLASS 时使用该 class (与管理范围一致)，否则不指定，交给集群默认 IngressClass
+	var className *string
+	if cfg.IngressClass != "" {
+		className = &cfg.IngressClass
+	}
+	pathType := networkingv1.PathTypePrefix
+	return &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       namespace,
+			Labels:          withScopeLabels(cfg, labels),
+			Annotations:     annotations,
+			OwnerReferences: []metav1.OwnerReference{owner},
+		},
+		Spec: networkingv1.IngressSpec{
+			IngressClassName: className,
+			Rules: []networkingv1.IngressRule{{
+				Host: host,
+				IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{
+					Paths: []networkingv1.HTTPIngressPath{{
+						Path:     "/",
+						PathType: &pathType,
+						Backend:  networkingv1.IngressBackend{Service: &backend},
+					}},
+				}},
+			}},
+		},
+	}
+}
+
+// mergeGeneratedIngress 只覆盖由我们生成的部分 (spec、归属、标签与 managedAnnotations)，保留同步状态注解与 finalizer
+func mergeGeneratedIngress(existing, desired *networkingv1.Ingress, managedAnnotations []string) *networkingv1.Ingress {
+	updated := existing.DeepCopy()
+	updated.Spec = desired.Spec
+	// 未指定 class 时沿用已有 Ingress 上的 class (准入控制器可能已写入集群默认值)，避免每次对账都来回改动
+	if updated.Spec.IngressClassName == nil {
+		updated.Spec.IngressClassName = existing.Spec.IngressClassName
+	}
+	updated.OwnerReferences = desired.OwnerReferences
+	if updated.Labels == nil {
+		updated.Labels = make(map[string]string)
+	}
+	for k, v := range desired.Labels {
+		updated.Labels[k] = v
+	}
+	if updated.Annotations == nil {
+		updated.Annotations = make(map[string]string)
+	}
+	for _, key := range managedAnnotations {
+		delete(updated.Annotations, key)
+	}
+	for k, v := range desired.Annotations {
+		updated.Annotations[k] = v
+	}
+	return updated
+}
+
+// exposedServicePort 解析要暴露的端口：端口号或端口名，未填写时取第一个端口
+func exposedServicePort(svc *corev1.Service) (networkingv1.ServiceBackendPort, error) {
+	if len(svc.Spec.Ports) == 0 {
+		return networkingv1.ServiceBackendPort{}, fmt.Errorf("Service 没有声明任何端口")
+	}
+	value, ok := svc.Annotations[exposePortAnnotation]
+	if !ok || value == "" {
+		return networkingv1.ServiceBackendPort{Number: svc.Spec.Ports[0].Port}, nil
+	}
+	want := intstr.Parse(value)
+	for _, p := range svc.Spec.Ports {
+		if want.Type == intstr.Int && p.Port == want.IntVal {
+			return networkingv1.ServiceBackendPort{Number: p.Port}, nil
+		}
+		if want.Type == intstr.String && p.Name == want.StrVal {
+			return networkingv1.ServiceBackendPort{Name: p.Name}, nil
+		}
+	}
+	return networkingv1.ServiceBackendPort{}, fmt.Errorf("%s=%s 在 Service 中不存在", exposePortAnnotation, strconv.Quote(value))
+}
+
+func exposeFailed(svc *corev1.Service, err error) {
+	slog.Warn("Service 快速暴露失败", "namespace", svc.Namespace, "service", svc.Name, "error", err)
+	if eventRecorder != nil {
+		eventRecorder.Eventf(svc, corev1.EventTypeWarning, "ExposeFailed", "快速暴露失败: %v", err)
+	}
+}
@@ -0,0 +1,44 @@
+package internal
+
+import (
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNewRoutingIngressClass(t *testing.T) {
+	backend := networkingv1.IngressServiceBackend{Name: "web", Port: networkingv1.ServiceBackendPort{Number: 80}}
+	owner := metav1.OwnerReference{APIVersion: "v1", Kind: "Service", Name: "web"}
+
+	// 未配置 INGRESS_CLASS：不指定 class，交给集群默认 IngressClass
+	ing := newRoutingIngress(Config{}, "web-bt-expose", "app", "www.example.com", backend, owner, nil, nil)
+	if ing.Spec.IngressClassName != nil {
+		t.Errorf("IngressClassName = %q, want nil", *ing.Spec.IngressClassName)
+	}
+
+	// 配置了 INGRESS_CLASS：使用管理范围内的 class，生成的 Ingress 仍在范围内
+	cfg := Config{IngressClass: "traefik", LabelSelector: "team=blue"}
+	ing = newRoutingIngress(cfg, "web-bt-expose", "app", "www.example.com", backend, owner, nil, nil)
+	if ing.Spec.IngressClassName == nil || *ing.Spec.IngressClassName != "traefik" {
+		t.Errorf("IngressClassName = %v, want traefik", ing.Spec.IngressClassName)
+	}
+	if ing.Labels["team"] != "blue" {
+		t.Errorf("labels = %v, want team=blue", ing.Labels)
+	}
+}
+
+func TestMergeGeneratedIngressKeepsDefaultedClass(t *testing.T) {
+	class := "nginx"
+	existing := &networkingv1.Ingress{Spec: networkingv1.IngressSpec{IngressClassName: &class}}
+	desired := &networkingv1.Ingress{}
+	if got := mergeGeneratedIngress(existing, desired, nil).Spec.IngressClassName; got == nil || *got != "nginx" {
+		t.Errorf("IngressClassName = %v, want nginx", got)
+	}
+
+	want := "traefik"
+	desired.Spec.IngressClassName = &want
+	if got := mergeGeneratedIngress(existing, desired, nil).Spec.IngressClassName; got == nil || *got != "traefik" {
+		t.Errorf("IngressClassName = %v, want traefik", got)
+	}
+}
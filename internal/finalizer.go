@@ -0,0 +1,165 @@
+package internal
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+)
+
+// CleanupFinalizer 挂在删除策略非 retain 的 Ingress 上，保证宝塔端清理完成前 Ingress 不会真正消失
+// (即使 Ingress 是在本工具停机期间被删除的)
+const CleanupFinalizer = "kube-bt-sync.io/cleanup"
+
+// 逃生注解：宝塔面板已永久下线、无法清理时，设为 "true" 即可直接放行删除
+const skipCleanupAnnotation = "kube-bt-sync.io/skip-cleanup"
+
+// routeRef 按路由 (而非域名) 投递进同步队列的条目，用于处理删除中、持有 finalizer 的路由
+// 这类路由的域名可能已被清空或改名，按域名投递无法保证能轮到它
+type routeRef struct {
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+func (r routeRef) String() string {
+	return r.Kind + " " + r.Namespace + "/" + r.Name
+}
+
+// finalizeMutex 按域名与按路由两条路径都可能清理同一个路由，串行执行，后到者发现 finalizer 已摘除即跳过
+var finalizeMutex sync.Mutex
+
+// enqueueFinalize 删除中且持有 finalizer 的路由，无论声明了哪些域名都单独投递一次
+func enqueueFinalize(ing networkingv1.Ingress) {
+	if ing.DeletionTimestamp != nil && hasCleanupFinalizer(ing) {
+		syncQueue.Add(routeRef{Kind: routeKind(ing), Namespace: ing.Namespace, Name: ing.Name})
+	}
+}
+
+func hasCleanupFinalizer(ing networkingv1.Ingress) bool {
+	for _, f := range ing.Finalizers {
+		if f == CleanupFinalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// needsCleanupFinalizer 仍在同步、未被删除且删除策略需要清理宝塔端的 Ingress 才需要 finalizer
+func needsCleanupFinalizer(cfg Config, ing networkingv1.Ingress) bool {
+	if !wantsSync(cfg, ing) {
+		return false
+	}
+	return ing.DeletionTimestamp == nil && parseDeletionPolicy(ing) != DeletionPolicyRetain
+}
+
+func declaresHost(ing networkingv1.Ingress, host string) bool {
+	for _, rule := range ing.Spec.Rules {
+		if rule.Host == host {
+			return true
+		}
+	}
+	return false
+}
+
+// ensureCleanupFinalizer 域名下发成功后，给其所属路由补上 finalizer
+func ensureCleanupFinalizer(clientset *kubernetes.Clientset, cfg Config, target ProxyTarget) error {
+	if target.DeletionPolicy == DeletionPolicyRetain {
+		return nil
+	}
+	return updateRouteFinalizers(clientset, target.Kind, target.Namespace, target.Ingress, func(ing networkingv1.Ingress) ([]string, bool) {
+		if hasCleanupFinalizer(ing) || !needsCleanupFinalizer(cfg, ing) {
+			return nil, false
+		}
+		return append(ing.Finalizers, CleanupFinalizer), true
+	})
+}
+
+func removeCleanupFinalizer(clientset *kubernetes.Clientset, kind, namespace, name string) error {
+	return updateRouteFinalizers(clientset, kind, namespace, name, func(ing networkingv1.Ingress) ([]string, bool) {
+		var kept []string
+		for _, f := range ing.Finalizers {
+			if f != CleanupFinalizer {
+				kept = append(kept, f)
+			}
+		}
+		return kept, len(kept) != len(ing.Finalizers)
+	})
+}
+
+// finalizeIngress 按 Ingress 当前的删除策略清理其声明的全部域名，全部成功后摘掉 finalizer
+// 已被其它存活 Ingress 接管的域名不做任何宝塔操作；dry-run 模式下不做任何事 (Ingress 保持 Terminating，计划中会列出)
+func finalizeIngress(clientset *kubernetes.Clientset, cfg Config, ing networkingv1.Ingress, targets map[string]ProxyTarget) error {
+	if cfg.DryRun {
+		return nil
+	}
+	finalizeMutex.Lock()
+	defer finalizeMutex.Unlock()
+
+	// 以最新版本为准：另一条路径可能已经完成清理
+	current, _, err := getRoute(clientset, routeKind(ing), ing.Namespace, ing.Name)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("读取路由失败: %w", err)
+	}
+	if !hasCleanupFinalizer(*current) {
+		return nil
+	}
+	ing = *current
+
+	owner := ing.Namespace + "/" + ing.Name
+	skip := ing.Annotations[skipCleanupAnnotation] == "true"
+	policy := parseDeletionPolicy(ing)
+
+	for _, rule := range ing.Spec.Rules {
+		if rule.Host == "" {
+			continue
+		}
+		if _, stillWanted := targets[rule.Host]; stillWanted {
+			continue
+		}
+
+		if skip {
+			slog.Warn("路由设置了跳过清理注解，跳过宝塔端清理", "host", rule.Host, "kind", routeKind(ing), "namespace", ing.Namespace, "ingress", ing.Name, "annotation", skipCleanupAnnotation)
+			recordHistory(rule.Host, owner, "skip-cleanup", nil)
+		} else if err := applyDeletionPolicy(cfg, rule.Host, SyncRecord{Kind: routeKind(ing), Namespace: ing.Namespace, Ingress: ing.Name, DeletionPolicy: policy}); err != nil {
+			return err
+		}
+
+		cacheMutex.Lock()
+		delete(syncedCache, rule.Host)
+		cacheMutex.Unlock()
+	}
+
+	if err := removeCleanupFinalizer(clientset, routeKind(ing), ing.Namespace, ing.Name); err != nil {
+		return err
+	}
+	slog.Info("宝塔端清理完成，已移除 finalizer", "kind", routeKind(ing), "namespace", ing.Namespace, "ingress", ing.Name)
+	return nil
+}
+
+// reconcileFinalizer 处理按路由投递的队列条目 (dry-run 模式下由按域名的计划负责输出)
+func reconcileFinalizer(clientset *kubernetes.Clientset, cfg Config, ref routeRef) error {
+	if cfg.DryRun {
+		return nil
+	}
+	ingresses, err := snapshotRoutes(clientset, cfg)
+	if err != nil {
+		return fmt.Errorf("获取 Ingress 列表失败: %w", err)
+	}
+	targets := collectTargets(cfg, ingresses)
+	for _, ing := range ingresses {
+		if routeKind(ing) != ref.Kind || ing.Namespace != ref.Namespace || ing.Name != ref.Name {
+			continue
+		}
+		if hasCleanupFinalizer(ing) && !needsCleanupFinalizer(cfg, ing) {
+			return finalizeIngress(clientset, cfg, ing, targets)
+		}
+	}
+	return nil
+}
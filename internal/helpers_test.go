@@ -0,0 +1,119 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// newTestClientset 指向本地 httptest 服务器的 Clientset，由 handler 模拟 API Server 的响应
+func newTestClientset(t *testing.T, handler http.Handler) *kubernetes.Clientset {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	clientset, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return clientset
+}
+
+// fakeConfigMaps 内存中的 ConfigMap 存储，支持 Get / Create / Update (按 resourceVersion 检测冲突)
+type fakeConfigMaps struct {
+	mu    sync.Mutex
+	items map[string]*corev1.ConfigMap // namespace/name
+	rv    int
+}
+
+func newFakeConfigMaps() *fakeConfigMaps {
+	return &fakeConfigMaps{items: make(map[string]*corev1.ConfigMap)}
+}
+
+func (f *fakeConfigMaps) get(namespace, name string) *corev1.ConfigMap {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if cm, ok := f.items[namespace+"/"+name]; ok {
+		return cm.DeepCopy()
+	}
+	return nil
+}
+
+func (f *fakeConfigMaps) put(cm *corev1.ConfigMap) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rv++
+	cm = cm.DeepCopy()
+	cm.ResourceVersion = strconv.Itoa(f.rv)
+	f.items[cm.Namespace+"/"+cm.Name] = cm
+}
+
+func (f *fakeConfigMaps) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// /api/v1/namespaces/<ns>/configmaps[/<name>]
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 5 || parts[0] != "api" || parts[4] != "configmaps" {
+		writeStatus(w, http.StatusNotFound, "NotFound")
+		return
+	}
+	namespace := parts[3]
+	w.Header().Set("Content-Type", "application/json")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodGet:
+		cm, ok := f.items[namespace+"/"+parts[5]]
+		if !ok {
+			writeStatus(w, http.StatusNotFound, "NotFound")
+			return
+		}
+		json.NewEncoder(w).Encode(cm)
+	case http.MethodPost, http.MethodPut:
+		var cm corev1.ConfigMap
+		if err := json.NewDecoder(r.Body).Decode(&cm); err != nil {
+			writeStatus(w, http.StatusBadRequest, "BadRequest")
+			return
+		}
+		cm.Namespace = namespace
+		existing, ok := f.items[namespace+"/"+cm.Name]
+		switch {
+		case r.Method == http.MethodPost && ok:
+			writeStatus(w, http.StatusConflict, "AlreadyExists")
+			return
+		case r.Method == http.MethodPut && !ok:
+			writeStatus(w, http.StatusNotFound, "NotFound")
+			return
+		case r.Method == http.MethodPut && existing.ResourceVersion != cm.ResourceVersion:
+			writeStatus(w, http.StatusConflict, "Conflict")
+			return
+		}
+		size := 0
+		for k, v := range cm.Data {
+			size += len(k) + len(v)
+		}
+		if size > 1024*1024 {
+			writeStatus(w, http.StatusUnprocessableEntity, "Invalid")
+			return
+		}
+		f.rv++
+		cm.ResourceVersion = strconv.Itoa(f.rv)
+		f.items[namespace+"/"+cm.Name] = &cm
+		json.NewEncoder(w).Encode(&cm)
+	default:
+		writeStatus(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+func writeStatus(w http.ResponseWriter, code int, reason string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	fmt.Fprintf(w, `{"kind":"Status","apiVersion":"v1","status":"Failure","reason":%q,"code":%d}`, reason, code)
+}
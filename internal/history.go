@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"sync"
+	"time"
+)
+
+// 同步历史最多保留的条数，超出后丢弃最旧的记录
+const maxSyncHistory = 200
+
+// SyncEvent 一条同步历史：记录某个域名在宝塔端被执行了什么动作以及结果
+type SyncEvent struct {
+	Time    string `json:"time"`
+	Domain  string `json:"domain"`
+	Ingress string `json:"ingress"`
+	Action  string `json:"action"`
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+}
+
+var syncHistory []SyncEvent
+var historyMutex sync.RWMutex
+
+func recordHistory(domain, ingress, action string, err error) {
+	message := "成功"
+	if err != nil {
+		message = err.Error()
+	}
+	appendHistory(domain, ingress, action, err == nil, message)
+}
+
+// recordHistoryNote 记录一条说明性质的历史 (例如发现漂移)，本身不代表失败
+func recordHistoryNote(domain, ingress, action, message string) {
+	appendHistory(domain, ingress, action, true, message)
+}
+
+func appendHistory(domain, ingress, action string, success bool, message string) {
+	event := SyncEvent{
+		Time:    time.Now().Format("2006-01-02 15:04:05"),
+		Domain:  domain,
+		Ingress: ingress,
+		Action:  action,
+		Success: success,
+		Message: message,
+	}
+
+	historyMutex.Lock()
+	syncHistory = append(syncHistory, event)
+	if len(syncHistory) > maxSyncHistory {
+		syncHistory = syncHistory[len(syncHistory)-maxSyncHistory:]
+	}
+	historyMutex.Unlock()
+}
+
+// GetSyncHistory 按时间倒序返回同步历史
+func GetSyncHistory() []SyncEvent {
+	historyMutex.RLock()
+	defer historyMutex.RUnlock()
+
+	result := make([]SyncEvent, 0, len(syncHistory))
+	for i := len(syncHistory) - 1; i >= 0; i-- {
+		result = append(result, syncHistory[i])
+	}
+	return result
+}
@@ -0,0 +1,226 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// 除 Ingress 外，同样支持带有同步注解的 Gateway API HTTPRoute
+const (
+	KindIngress   = "Ingress"
+	KindHTTPRoute = "HTTPRoute"
+)
+
+const gatewayAPIGroup = "gateway.networking.k8s.io"
+
+// routeParentsAnnotation HTTPRoute 挂载的 Gateway 列表 (namespace/name，逗号分隔)，只存在于内存中的 Ingress 形式上，不会写回集群
+const routeParentsAnnotation = "kube-bt-sync.io/internal-parent-refs"
+
+// HTTPRoute 通过 dynamic client 访问，无需引入 Gateway API 的 Go 类型
+var dynamicClient dynamic.Interface
+
+// httpRouteResource 集群中可用的 HTTPRoute 版本，为空表示未启用
+var httpRouteResource schema.GroupVersionResource
+
+// httpRoute HTTPRoute 中我们关心的字段子集
+type httpRoute struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              struct {
+		ParentRefs []struct {
+			Group     string `json:"group"`
+			Kind      string `json:"kind"`
+			Namespace string `json:"namespace"`
+			Name      string `json:"name"`
+		} `json:"parentRefs"`
+		Hostnames []string `json:"hostnames"`
+		Rules     []struct {
+			Matches []struct {
+				Path *struct {
+					Type  string `json:"type"`
+					Value string `json:"value"`
+				} `json:"path"`
+			} `json:"matches"`
+		} `json:"rules"`
+	} `json:"spec"`
+}
+
+// DetectGatewayAPI 按 GATEWAY_API 配置决定是否同步 HTTPRoute：auto 时通过 discovery 检测集群是否安装了 Gateway API
+func DetectGatewayAPI(clientset *kubernetes.Clientset, cfg Config) {
+	if cfg.GatewayAPI == "false" {
+		return
+	}
+	for _, version := range []string{"v1", "v1beta1"} {
+		resources, err := clientset.Discovery().ServerResourcesForGroupVersion(gatewayAPIGroup + "/" + version)
+		if err != nil {
+			continue
+		}
+		for _, r := range resources.APIResources {
+			if r.Name == "httproutes" {
+				httpRouteResource = schema.GroupVersionResource{Group: gatewayAPIGroup, Version: version, Resource: "httproutes"}
+				slog.Info("检测到 Gateway API，HTTPRoute 将与 Ingress 一起同步", "group", gatewayAPIGroup, "version", version)
+				return
+			}
+		}
+	}
+	if cfg.GatewayAPI == "true" {
+		fatal("GATEWAY_API=true，但集群中未找到 HTTPRoute 资源", "group", gatewayAPIGroup)
+	}
+}
+
+func gatewayAPIEnabled() bool {
+	return httpRouteResource.Resource != "" && dynamicClient != nil
+}
+
+func httpRoutes(namespace string) dynamic.ResourceInterface {
+	return dynamicClient.Resource(httpRouteResource).Namespace(namespace)
+}
+
+// listHTTPRoutes 按管理范围列出 HTTPRoute，并转换为同步引擎统一处理的 Ingress 形式
+func listHTTPRoutes(cfg Config) ([]networkingv1.Ingress, error) {
+	if !gatewayAPIEnabled() {
+		return nil, nil
+	}
+	var items []networkingv1.Ingress
+	for _, ns := range scopedNamespaces(cfg) {
+		list, err := httpRoutes(ns).List(context.TODO(), metav1.ListOptions{LabelSelector: cfg.LabelSelector})
+		if err != nil {
+			return nil, fmt.Errorf("获取 HTTPRoute 列表失败: %w", err)
+		}
+		for i := range list.Items {
+			ing, err := httpRouteToIngress(&list.Items[i])
+			if err != nil {
+				slog.Warn("解析 HTTPRoute 失败", "kind", KindHTTPRoute, "namespace", list.Items[i].GetNamespace(), "ingress", list.Items[i].GetName(), "error", err)
+				continue
+			}
+			items = append(items, ing)
+		}
+	}
+	return items, nil
+}
+
+// httpRouteToIngress 把 HTTPRoute 的 hostnames 与路径匹配转换为 Ingress 规则，Kind 标记为 HTTPRoute
+func httpRouteToIngress(u *unstructured.Unstructured) (networkingv1.Ingress, error) {
+	var route httpRoute
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &route); err != nil {
+		return networkingv1.Ingress{}, err
+	}
+
+	var paths []networkingv1.HTTPIngressPath
+	for _, rule := range route.Spec.Rules {
+		for _, match := range rule.Matches {
+			if match.Path == nil || match.Path.Value == "" {
+				continue
+			}
+			pathType := networkingv1.PathTypePrefix
+			switch match.Path.Type {
+			case "Exact":
+				pathType = networkingv1.PathTypeExact
+			case "RegularExpression":
+				pathType = networkingv1.PathTypeImplementationSpecific
+			}
+			paths = append(paths, networkingv1.HTTPIngressPath{Path: match.Path.Value, PathType: &pathType})
+		}
+	}
+	if len(paths) == 0 {
+		pathType := networkingv1.PathTypePrefix
+		paths = append(paths, networkingv1.HTTPIngressPath{Path: "/", PathType: &pathType})
+	}
+
+	// group / kind / namespace 省略时分别默认为 Gateway API、Gateway 与路由自身的命名空间
+	var parents []string
+	for _, ref := range route.Spec.ParentRefs {
+		if (ref.Group != "" && ref.Group != gatewayAPIGroup) || (ref.Kind != "" && ref.Kind != "Gateway") {
+			continue
+		}
+		namespace := ref.Namespace
+		if namespace == "" {
+			namespace = route.Namespace
+		}
+		parents = append(parents, namespace+"/"+ref.Name)
+	}
+	annotations := make(map[string]string)
+	for k, v := range route.Annotations {
+		annotations[k] = v
+	}
+	delete(annotations, routeParentsAnnotation)
+	if len(parents) > 0 {
+		annotations[routeParentsAnnotation] = strings.Join(parents, ",")
+	}
+	route.Annotations = annotations
+
+	ing := networkingv1.Ingress{
+		TypeMeta:   metav1.TypeMeta{Kind: KindHTTPRoute, APIVersion: u.GetAPIVersion()},
+		ObjectMeta: route.ObjectMeta,
+	}
+	for _, host := range route.Spec.Hostnames {
+		ing.Spec.Rules = append(ing.Spec.Rules, networkingv1.IngressRule{
+			Host:             host,
+			IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{Paths: paths}},
+		})
+	}
+	return ing, nil
+}
+
+// routeGateways HTTPRoute 挂载的 Gateway (namespace/name)
+func routeGateways(ing networkingv1.Ingress) []string {
+	return splitList(ing.Annotations[routeParentsAnnotation])
+}
+
+// gatewayMatches HTTPRoute 是否挂载在 NAT 端口背后的 Gateway 上 (未配置 GATEWAY_NAME 时全部匹配)
+// 未配置 GATEWAY_NAMESPACE 时只比对名称
+func gatewayMatches(cfg Config, ing networkingv1.Ingress) bool {
+	if cfg.GatewayName == "" {
+		return true
+	}
+	for _, parent := range routeGateways(ing) {
+		namespace, name, _ := strings.Cut(parent, "/")
+		if name == cfg.GatewayName && (cfg.GatewayNamespace == "" || namespace == cfg.GatewayNamespace) {
+			return true
+		}
+	}
+	return false
+}
+
+// watchHTTPRoutes 与 Ingress 监听器相同的事件处理，只是数据源换成 HTTPRoute
+func watchHTTPRoutes(k8sClient *kubernetes.Clientset, cfg Config, namespace string) {
+	for {
+		watcher, err := httpRoutes(namespace).Watch(context.TODO(), metav1.ListOptions{LabelSelector: cfg.LabelSelector})
+		if err != nil {
+			slog.Error("监听 HTTPRoute 失败，5秒后重试", "kind", KindHTTPRoute, "namespace", namespace, "error", err)
+			watchReconnects.WithLabelValues("HTTPRoute", "error").Inc()
+			time.Sleep(5 * time.Second)
+			continue
+		}
+
+		TriggerSync(k8sClient, cfg)
+
+		for event := range watcher.ResultChan() {
+			u, ok := event.Object.(*unstructured.Unstructured)
+			if !ok {
+				continue
+			}
+			invalidateRouteSnapshot()
+			route, err := httpRouteToIngress(u)
+			if err != nil || !IsManagedIngress(cfg, &route) {
+				continue
+			}
+			slog.Info("路由事件，已加入同步队列", "kind", KindHTTPRoute, "namespace", route.Namespace, "ingress", route.Name, "event", event.Type)
+			EnqueueIngress(&route)
+		}
+
+		watchReconnects.WithLabelValues("HTTPRoute", "closed").Inc()
+		time.Sleep(2 * time.Second)
+	}
+}
@@ -0,0 +1,92 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func testHTTPRoute(spec map[string]any) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "gateway.networking.k8s.io/v1",
+		"kind":       "HTTPRoute",
+		"metadata": map[string]any{
+			"name":        "web",
+			"namespace":   "app",
+			"annotations": map[string]any{"kube-bt-sync.io/baota-sync": "true", routeParentsAnnotation: "stale/value"},
+		},
+		"spec": spec,
+	}}
+}
+
+func TestHTTPRouteToIngress(t *testing.T) {
+	u := testHTTPRoute(map[string]any{
+		"hostnames": []any{"www.example.com", "api.example.com"},
+		"parentRefs": []any{
+			map[string]any{"name": "public"},
+			map[string]any{"name": "internal", "namespace": "infra", "group": gatewayAPIGroup, "kind": "Gateway"},
+			map[string]any{"name": "svc", "kind": "Service", "group": ""},
+		},
+		"rules": []any{
+			map[string]any{"matches": []any{
+				map[string]any{"path": map[string]any{"type": "PathPrefix", "value": "/api"}},
+				map[string]any{"path": map[string]any{"type": "Exact", "value": "/healthz"}},
+				map[string]any{"headers": []any{map[string]any{"name": "x", "value": "y"}}},
+			}},
+		},
+	})
+	ing, err := httpRouteToIngress(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if routeKind(ing) != KindHTTPRoute || ing.Namespace != "app" || ing.Name != "web" {
+		t.Fatalf("kind/namespace/name = %s %s/%s", routeKind(ing), ing.Namespace, ing.Name)
+	}
+	// 非 Gateway 的 parentRef 被忽略，省略的命名空间取路由自身的命名空间，旧的注解被覆盖
+	if got, want := routeGateways(ing), []string{"app/public", "infra/internal"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("routeGateways = %v, want %v", got, want)
+	}
+	if len(ing.Spec.Rules) != 2 || ing.Spec.Rules[1].Host != "api.example.com" {
+		t.Fatalf("rules = %+v", ing.Spec.Rules)
+	}
+	paths := ing.Spec.Rules[0].HTTP.Paths
+	if len(paths) != 2 || paths[0].Path != "/api" || *paths[0].PathType != networkingv1.PathTypePrefix ||
+		paths[1].Path != "/healthz" || *paths[1].PathType != networkingv1.PathTypeExact {
+		t.Errorf("paths = %+v", paths)
+	}
+
+	// 没有路径匹配时按整站 "/" 处理
+	ing, err = httpRouteToIngress(testHTTPRoute(map[string]any{"hostnames": []any{"www.example.com"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if paths := ing.Spec.Rules[0].HTTP.Paths; len(paths) != 1 || paths[0].Path != "/" {
+		t.Errorf("paths = %+v", paths)
+	}
+	if got := routeGateways(ing); len(got) != 0 {
+		t.Errorf("routeGateways = %v, want none", got)
+	}
+}
+
+func TestGatewayMatches(t *testing.T) {
+	route := testRoute("web", "www.example.com", map[string]string{routeParentsAnnotation: "infra/public,app/internal"})
+	cases := []struct {
+		name, namespace string
+		want            bool
+	}{
+		{"", "", true},
+		{"public", "", true},
+		{"public", "infra", true},
+		{"public", "app", false},
+		{"internal", "app", true},
+		{"other", "", false},
+	}
+	for _, c := range cases {
+		cfg := Config{GatewayName: c.name, GatewayNamespace: c.namespace}
+		if got := gatewayMatches(cfg, route); got != c.want {
+			t.Errorf("gatewayMatches(%s/%s) = %v, want %v", c.namespace, c.name, got, c.want)
+		}
+	}
+}
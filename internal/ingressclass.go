@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// 旧版 Ingress 通过注解声明 IngressClass
+const legacyIngressClassAnnotation = "kubernetes.io/ingress.class"
+
+// 集群默认 IngressClass 的标记注解
+const defaultIngressClassAnnotation = "ingressclass.kubernetes.io/is-default-class"
+
+// 默认 IngressClass 的缓存时间，避免每次对账都查询一次
+const defaultIngressClassTTL = time.Minute
+
+var defaultIngressClass string
+var defaultIngressClassKnown bool // 至少成功查询过一次
+var defaultIngressClassAt time.Time
+var ingressClassMutex sync.RWMutex
+
+// refreshDefaultIngressClass 查询集群默认的 IngressClass (未开启 INGRESS_CLASS 过滤时不查询)
+// 查询失败 (例如缺少 ingressclasses 权限) 时沿用上一次的结果；从未查询成功时返回错误
+func refreshDefaultIngressClass(clientset *kubernetes.Clientset, cfg Config) error {
+	if cfg.IngressClass == "" {
+		return nil
+	}
+	ingressClassMutex.RLock()
+	fresh := time.Since(defaultIngressClassAt) < defaultIngressClassTTL
+	known := defaultIngressClassKnown
+	ingressClassMutex.RUnlock()
+	if fresh && known {
+		return nil
+	}
+
+	name := ""
+	classes, err := clientset.NetworkingV1().IngressClasses().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		slog.Warn("获取 IngressClass 列表失败，沿用上一次查询到的默认 class", "error", err)
+	} else {
+		for _, ic := range classes.Items {
+			if ic.Annotations[defaultIngressClassAnnotation] == "true" {
+				name = ic.Name
+				break
+			}
+		}
+	}
+
+	ingressClassMutex.Lock()
+	defer ingressClassMutex.Unlock()
+	defaultIngressClassAt = time.Now()
+	if err == nil {
+		defaultIngressClass, defaultIngressClassKnown = name, true
+		return nil
+	}
+	if defaultIngressClassKnown {
+		return nil
+	}
+	return fmt.Errorf("集群默认 IngressClass 未知: %w", err)
+}
+
+// usesDefaultIngressClass 未声明 class、需要依赖集群默认 IngressClass 判断是否匹配的 Ingress
+func usesDefaultIngressClass(ing networkingv1.Ingress) bool {
+	return (ing.Spec.IngressClassName == nil || *ing.Spec.IngressClassName == "") && ing.Annotations[legacyIngressClassAnnotation] == ""
+}
+
+// effectiveIngressClass 依次取 spec.ingressClassName、旧版注解、集群默认 IngressClass
+func effectiveIngressClass(ing networkingv1.Ingress) string {
+	if !usesDefaultIngressClass(ing) {
+		if ing.Spec.IngressClassName != nil && *ing.Spec.IngressClassName != "" {
+			return *ing.Spec.IngressClassName
+		}
+		return ing.Annotations[legacyIngressClassAnnotation]
+	}
+	ingressClassMutex.RLock()
+	defer ingressClassMutex.RUnlock()
+	return defaultIngressClass
+}
+
+// ingressClassMatches 路由是否由 NAT 端口背后的那个控制器承接：Ingress 比对 INGRESS_CLASS，HTTPRoute 比对 GATEWAY_NAME
+// EdgeRoute 没有对应的概念，不受该过滤影响
+func ingressClassMatches(cfg Config, ing networkingv1.Ingress) bool {
+	switch routeKind(ing) {
+	case KindIngress:
+		return cfg.IngressClass == "" || effectiveIngressClass(ing) == cfg.IngressClass
+	case KindHTTPRoute:
+		return gatewayMatches(cfg, ing)
+	}
+	return true
+}
+
+// wantsSync 带有同步注解且 IngressClass 匹配的 Ingress 才会被下发到宝塔
+func wantsSync(cfg Config, ing networkingv1.Ingress) bool {
+	if val, ok := ing.Annotations["kube-bt-sync.io/baota-sync"]; !ok || val != "true" {
+		return false
+	}
+	return ingressClassMatches(cfg, ing)
+}
@@ -0,0 +1,47 @@
+package internal
+
+import "testing"
+
+// setDefaultIngressClass 模拟集群默认 IngressClass，测试结束后恢复
+func setDefaultIngressClass(t *testing.T, name string) {
+	t.Helper()
+	ingressClassMutex.Lock()
+	saved := defaultIngressClass
+	defaultIngressClass = name
+	ingressClassMutex.Unlock()
+	t.Cleanup(func() {
+		ingressClassMutex.Lock()
+		defaultIngressClass = saved
+		ingressClassMutex.Unlock()
+	})
+}
+
+func TestIngressClassMatches(t *testing.T) {
+	setDefaultIngressClass(t, "nginx")
+
+	cases := []struct {
+		name        string
+		className   string
+		annotations map[string]string
+		filter      string
+		want        bool
+	}{
+		{"未配置过滤", "traefik", nil, "", true},
+		{"spec.ingressClassName 匹配", "traefik", nil, "traefik", true},
+		{"spec.ingressClassName 不匹配", "traefik", nil, "nginx", false},
+		{"旧版注解", "", map[string]string{legacyIngressClassAnnotation: "traefik"}, "traefik", true},
+		{"spec 优先于旧版注解", "nginx", map[string]string{legacyIngressClassAnnotation: "traefik"}, "traefik", false},
+		{"未声明时取集群默认", "", nil, "nginx", true},
+		{"未声明且默认不匹配", "", nil, "traefik", false},
+	}
+	for _, c := range cases {
+		ing := testRoute("web", "www.example.com", c.annotations)
+		if c.className != "" {
+			class := c.className
+			ing.Spec.IngressClassName = &class
+		}
+		if got := ingressClassMatches(Config{IngressClass: c.filter}, ing); got != c.want {
+			t.Errorf("%s: ingressClassMatches = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
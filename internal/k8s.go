@@ -1,9 +1,13 @@
 package internal
 
 import (
-	"log"
+	"context"
 	"os"
 
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -15,13 +19,100 @@ func InitK8sClient() *kubernetes.Clientset {
 		kubeconfig := getEnv("KUBECONFIG", os.Getenv("HOME")+"/.kube/config")
 		config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
 		if err != nil {
-			log.Fatalf("无法获取 K8s 配置: %v", err)
+			fatal("无法获取 K8s 配置", "error", err)
 		}
 	}
 
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
-		log.Fatalf("创建 K8s 客户端失败: %v", err)
+		fatal("创建 K8s 客户端失败", "error", err)
+	}
+	// HTTPRoute 等非内置资源通过 dynamic client 访问
+	dynamicClient, err = dynamic.NewForConfig(config)
+	if err != nil {
+		fatal("创建 K8s dynamic 客户端失败", "error", err)
 	}
 	return clientset
-}
\ No newline at end of file
+}
+
+// scopedNamespaces 返回需要访问的命名空间列表，未限定时返回 [""] 表示全部命名空间
+func scopedNamespaces(cfg Config) []string {
+	if len(cfg.WatchNamespaces) == 0 {
+		return []string{""}
+	}
+	return cfg.WatchNamespaces
+}
+
+// namespaceInScope 命名空间是否在本实例的管理范围内
+func namespaceInScope(cfg Config, namespace string) bool {
+	if len(cfg.WatchNamespaces) == 0 {
+		return true
+	}
+	for _, ns := range cfg.WatchNamespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// listIngresses 按命名空间与标签选择器列出本实例负责的 Ingress
+// 限定命名空间时逐个命名空间查询，只需要命名空间级别的 Role 权限
+// 存在依赖默认 IngressClass 的同步 Ingress、而默认 class 尚未查询成功时返回错误，
+// 避免把这些 Ingress 误判为“不再需要同步”并对宝塔端执行删除策略 (调用方会稍后重试)
+func listIngresses(clientset *kubernetes.Clientset, cfg Config) ([]networkingv1.Ingress, error) {
+	classErr := refreshDefaultIngressClass(clientset, cfg)
+	var items []networkingv1.Ingress
+	for _, ns := range scopedNamespaces(cfg) {
+		list, err := clientset.NetworkingV1().Ingresses(ns).List(context.TODO(), metav1.ListOptions{LabelSelector: cfg.LabelSelector})
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, list.Items...)
+	}
+	if classErr != nil {
+		for _, ing := range items {
+			if ing.Annotations["kube-bt-sync.io/baota-sync"] == "true" && usesDefaultIngressClass(ing) {
+				return nil, classErr
+			}
+		}
+	}
+	return items, nil
+}
+
+// ingressInScope Ingress 是否在本实例的管理范围内 (命名空间与标签选择器都匹配)
+func ingressInScope(cfg Config, ing *networkingv1.Ingress) bool {
+	if !namespaceInScope(cfg, ing.Namespace) {
+		return false
+	}
+	if cfg.LabelSelector == "" {
+		return true
+	}
+	selector, err := labels.Parse(cfg.LabelSelector)
+	if err != nil {
+		return false
+	}
+	return selector.Matches(labels.Set(ing.Labels))
+}
+
+// withScopeLabels 本工具创建 / 控制台提交路由时，补齐标签选择器中等值条件要求、但尚未填写的标签
+// 选择器含有 in / notin / exists 等条件时无法推断，原样返回 (随后的 ingressInScope 会拒绝不匹配的路由)
+func withScopeLabels(cfg Config, current map[string]string) map[string]string {
+	if cfg.LabelSelector == "" {
+		return current
+	}
+	required, err := labels.ConvertSelectorToLabelsMap(cfg.LabelSelector)
+	if err != nil {
+		return current
+	}
+	result := make(map[string]string, len(current)+len(required))
+	for k, v := range current {
+		result[k] = v
+	}
+	for k, v := range required {
+		if _, ok := result[k]; !ok {
+			result[k] = v
+		}
+	}
+	return result
+}
@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestIngressInScope(t *testing.T) {
+	cases := []struct {
+		name       string
+		namespaces []string
+		selector   string
+		namespace  string
+		labels     map[string]string
+		want       bool
+	}{
+		{name: "不限制范围", namespace: "app", want: true},
+		{name: "命名空间不在范围内", namespaces: []string{"team-a"}, namespace: "team-b", want: false},
+		{name: "命名空间在范围内", namespaces: []string{"team-a"}, namespace: "team-a", want: true},
+		{name: "标签匹配", selector: "team=blue", namespace: "app", labels: map[string]string{"team": "blue"}, want: true},
+		{name: "标签不匹配", selector: "team=blue", namespace: "app", labels: map[string]string{"team": "red"}, want: false},
+		{name: "缺少标签不视为匹配", selector: "team=blue", namespace: "app", want: false},
+		{name: "集合条件", selector: "team in (blue,green)", namespace: "app", labels: map[string]string{"team": "green"}, want: true},
+		{name: "选择器无效", selector: "team==", namespace: "app", labels: map[string]string{"team": "blue"}, want: false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cfg := Config{WatchNamespaces: c.namespaces, LabelSelector: c.selector}
+			ing := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Namespace: c.namespace, Labels: c.labels}}
+			if got := ingressInScope(cfg, ing); got != c.want {
+				t.Errorf("ingressInScope() = %v, want %v", got, c.want)
+			}
+			if c.labels == nil && ing.Labels != nil {
+				t.Errorf("ingressInScope() 修改了 Ingress 的标签: %v", ing.Labels)
+			}
+		})
+	}
+}
+
+func TestWithScopeLabels(t *testing.T) {
+	current := map[string]string{"app": "web", "team": "red"}
+	got := withScopeLabels(Config{LabelSelector: "team=blue,env=prod"}, current)
+	if got["app"] != "web" || got["team"] != "red" || got["env"] != "prod" {
+		t.Errorf("withScopeLabels() = %v，应补齐缺失的 env 且不覆盖已有的 team", got)
+	}
+	if _, ok := current["env"]; ok {
+		t.Errorf("withScopeLabels() 修改了传入的 map")
+	}
+
+	// 含有集合条件时无法推断标签，原样返回
+	if got := withScopeLabels(Config{LabelSelector: "team in (blue)"}, current); len(got) != len(current) {
+		t.Errorf("withScopeLabels() = %v，集合条件不应补齐标签", got)
+	}
+}
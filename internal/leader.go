@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+var isLeader atomic.Bool
+var currentLeader atomic.Value
+
+// IsLeader 当前实例是否负责运行监听器与同步引擎 (未开启选主时恒为 true)
+func IsLeader() bool {
+	return isLeader.Load()
+}
+
+// LeaderIdentity 当前 Leader 的身份 (Pod 名称)
+func LeaderIdentity() string {
+	if identity, ok := currentLeader.Load().(string); ok {
+		return identity
+	}
+	return ""
+}
+
+// RunAsLeader 基于 Lease 选主，只有 Leader 执行 run (监听器、同步队列、周期对账)
+// 所有副本都会继续提供 Web 控制台与只读 API
+func RunAsLeader(clientset *kubernetes.Clientset, cfg Config, run func()) {
+	if !cfg.LeaderElection {
+		isLeader.Store(true)
+		currentLeader.Store(cfg.PodName)
+		run()
+		return
+	}
+
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta:  metav1.ObjectMeta{Name: cfg.LeaderElectionID, Namespace: cfg.PodNamespace},
+		Client:     clientset.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: cfg.PodName},
+	}
+
+	slog.Info("参与 Leader 选举", "namespace", cfg.PodNamespace, "lease", cfg.LeaderElectionID, "identity", cfg.PodName)
+	leaderelection.RunOrDie(context.Background(), leaderelection.LeaderElectionConfig{
+		Lock:          lock,
+		LeaseDuration: 15 * time.Second,
+		RenewDeadline: 10 * time.Second,
+		RetryPeriod:   2 * time.Second,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				slog.Info("已成为 Leader，启动同步引擎", "identity", cfg.PodName)
+				isLeader.Store(true)
+				run()
+			},
+			OnStoppedLeading: func() {
+				// 失去 Leader 身份后直接退出，由 K8s 重启后重新参选，避免两个实例同时操作宝塔
+				fatal("失去 Leader 身份，退出进程", "identity", cfg.PodName)
+			},
+			OnNewLeader: func(identity string) {
+				currentLeader.Store(identity)
+				if identity != cfg.PodName {
+					slog.Info("当前 Leader 为其它副本，本实例仅提供控制台服务", "leader", identity)
+				}
+			},
+		},
+	})
+}
@@ -0,0 +1,104 @@
+package internal
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 结构化日志：统一使用 log/slog，LOG_LEVEL 控制级别 (debug / info / warn / error)，LOG_FORMAT 控制输出格式 (text / json)
+// 常用字段保持一致，便于 Loki 等日志系统按字段检索：namespace / ingress / kind / host / action / duration / error
+
+const redacted = "***"
+
+// InitLogger 在读取其它配置之前调用，之后标准库 log 的输出也会经由 slog 输出
+// client-go 通过 klog 直接写 stderr，不经过这里的级别、格式与脱敏处理
+func InitLogger() {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(getEnv("LOG_LEVEL", "info"))); err != nil {
+		level = slog.LevelInfo
+	}
+
+	// 无论字段名是什么，日志中出现这些密钥 (以及宝塔签名使用的 md5(API_KEY)) 都替换为 ***
+	secrets := make([]string, 0, 4)
+	for _, key := range []string{"BAOTA_API_KEY", "AUTH_PASSWORD", "RFC2136_TSIG_SECRET"} {
+		if value := os.Getenv(key); value != "" {
+			secrets = append(secrets, value)
+		}
+	}
+	if key := os.Getenv("BAOTA_API_KEY"); key != "" {
+		secrets = append(secrets, fmt.Sprintf("%x", md5.Sum([]byte(key))))
+	}
+
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+		return redactAttr(a, secrets)
+	}}
+	var handler slog.Handler
+	if strings.EqualFold(getEnv("LOG_FORMAT", "text"), "json") {
+		handler = slog.NewJSONHandler(os.Stdout, opts)
+	} else {
+		handler = slog.NewTextHandler(os.Stdout, opts)
+	}
+	slog.SetDefault(slog.New(handler))
+}
+
+func redactAttr(a slog.Attr, secrets []string) slog.Attr {
+	switch key := strings.ToLower(a.Key); {
+	case strings.Contains(key, "apikey"), strings.Contains(key, "api_key"), strings.Contains(key, "password"),
+		strings.Contains(key, "secret"), strings.Contains(key, "token"):
+		return slog.String(a.Key, redacted)
+	}
+
+	var text string
+	switch v := a.Value.Any().(type) {
+	case string:
+		text = v
+	case error:
+		text = v.Error()
+	default:
+		return a
+	}
+	// 一个值可能同时包含多个密钥 (例如拼接了 API Key 与 TSIG 密钥的错误信息)，全部替换后再返回
+	replaced := text
+	for _, secret := range secrets {
+		replaced = strings.ReplaceAll(replaced, secret, redacted)
+	}
+	if replaced == text {
+		return a
+	}
+	return slog.String(a.Key, replaced)
+}
+
+// fatal 记录错误并退出进程 (slog 没有 Fatal 级别)
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// ginLogger 用 slog 输出 Web 请求日志，替代 gin 默认的文本格式
+func ginLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		level := slog.LevelInfo
+		switch status := c.Writer.Status(); {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		case c.Request.Method == "GET":
+			// 控制台会周期性刷新，成功的查询只在 debug 级别输出
+			level = slog.LevelDebug
+		}
+		slog.Log(context.Background(), level, "HTTP 请求",
+			"method", c.Request.Method, "path", c.Request.URL.Path, "status", c.Writer.Status(),
+			"client", c.ClientIP(), "user", c.GetString(gin.AuthUserKey), "duration", time.Since(start))
+	}
+}
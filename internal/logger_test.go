@@ -0,0 +1,37 @@
+package internal
+
+import (
+	"errors"
+	"log/slog"
+	"testing"
+)
+
+func TestRedactAttr(t *testing.T) {
+	secrets := []string{"bt-key", "tsig-secret"}
+	cases := []struct {
+		name string
+		attr slog.Attr
+		want string
+	}{
+		{"按字段名脱敏", slog.String("apiKey", "anything"), redacted},
+		{"按字段名脱敏 (token)", slog.String("X-Token", "anything"), redacted},
+		{"字符串中的密钥", slog.String("url", "https://panel/?k=bt-key"), "https://panel/?k=***"},
+		{"多个密钥全部替换", slog.String("detail", "bt-key / tsig-secret"), "*** / ***"},
+		{"error 中的密钥", slog.Any("error", errors.New("tsig-secret rejected, bt-key ok")), "*** rejected, *** ok"},
+		{"无密钥保持原样", slog.String("host", "a.example.com"), "a.example.com"},
+	}
+	for _, c := range cases {
+		got := redactAttr(c.attr, secrets)
+		if got.Key != c.attr.Key {
+			t.Errorf("%s: key = %q", c.name, got.Key)
+		}
+		if s := got.Value.Resolve().String(); s != c.want {
+			t.Errorf("%s: value = %q, want %q", c.name, s, c.want)
+		}
+	}
+
+	// 非字符串类型的值不做处理
+	if got := redactAttr(slog.Int("status", 200), secrets); got.Value.Int64() != 200 {
+		t.Errorf("int attr changed: %v", got)
+	}
+}
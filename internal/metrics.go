@@ -0,0 +1,176 @@
+package internal
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Prometheus 指标：由 METRICS_ADDR 上的 /metrics 暴露，用于对同步失败、宝塔 API 异常与 DDNS 不通等情况告警
+// 指标中带有全部托管域名，因此不与控制台共用端口 (控制台通常以 NodePort 对外)，也不经过 Basic Auth
+// 同步相关指标只在 Leader 上有意义，kube_bt_sync_leader 可用于在告警规则中过滤
+
+var (
+	syncAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kube_bt_sync_sync_total",
+		Help: "按域名统计的同步 (对账) 次数，result 为 success / failure",
+	}, []string{"host", "result"})
+
+	syncDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kube_bt_sync_sync_duration_seconds",
+		Help:    "单个域名一次对账的耗时",
+		Buckets: []float64{0.1, 0.5, 1, 2, 5, 10, 30, 60, 120},
+	}, []string{"result"})
+
+	baotaAPIDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kube_bt_sync_baota_api_duration_seconds",
+		Help:    "宝塔 API 调用耗时，action 为接口路径与 action 参数",
+		Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2, 5, 10, 15},
+	}, []string{"action"})
+
+	baotaAPIErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kube_bt_sync_baota_api_errors_total",
+		Help: "宝塔 API 调用失败次数，reason 为 transport (网络 / 超时) / http (非 2xx) / api (返回 status=false)",
+	}, []string{"action", "reason"})
+
+	watchReconnects = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kube_bt_sync_watch_reconnects_total",
+		Help: "K8s Watch 重新建立的次数，reason 为 closed (连接被 API Server 关闭) / error (建立失败)",
+	}, []string{"resource", "reason"})
+
+	ddnsResolved = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "kube_bt_sync_ddns_resolved",
+		Help: "最近一次系统检测中 DDNS 域名是否解析出 IPv4 地址 (1 / 0)",
+	})
+
+	ddnsPortReachable = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kube_bt_sync_ddns_port_reachable",
+		Help: "最近一次系统检测中 DDNS 域名的端口是否可以建立 TCP 连接 (1 / 0)",
+	}, []string{"port"})
+
+	ddnsCheckTime = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "kube_bt_sync_ddns_check_timestamp_seconds",
+		Help: "最近一次系统检测的时间，用于判断上面两项指标是否过期",
+	})
+
+	auditQueueFull = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "kube_bt_sync_audit_queue_full_total",
+		Help: "审计队列已满、记录方需要阻塞等待的次数",
+	})
+
+	auditEntriesLost = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "kube_bt_sync_audit_entries_lost_total",
+		Help: "重试后仍未能写入审计 ConfigMap、只保留在标准输出中的记录数",
+	})
+
+	auditCorrupt = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "kube_bt_sync_audit_corrupt_total",
+		Help: "发现审计 ConfigMap 内容无法解析的次数 (原始内容另存为 <AUDIT_CONFIGMAP>-corrupt-<版本号>)",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(syncAttempts, syncDuration, baotaAPIDuration, baotaAPIErrors, watchReconnects,
+		ddnsResolved, ddnsPortReachable, ddnsCheckTime, auditQueueFull, auditEntriesLost, auditCorrupt, managedRoutesCollector{})
+
+	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "kube_bt_sync_queue_depth",
+		Help: "同步队列中等待处理的域名数量",
+	}, func() float64 { return float64(syncQueue.Len()) }))
+
+	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "kube_bt_sync_leader",
+		Help: "当前副本是否为运行同步引擎的 Leader (1 / 0)",
+	}, func() float64 { return boolToFloat(IsLeader()) }))
+}
+
+// StartMetricsServer 在独立端口上提供 /metrics
+func StartMetricsServer(cfg Config) {
+	if cfg.MetricsAddr == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	slog.Info("Prometheus 指标已启动", "addr", cfg.MetricsAddr)
+	if err := http.ListenAndServe(cfg.MetricsAddr, mux); err != nil {
+		slog.Error("Prometheus 指标监听失败", "addr", cfg.MetricsAddr, "error", err)
+	}
+}
+
+// managedRoutesCollector 采集时按同步记录统计已托管的路由与域名数量，避免在各处维护计数
+type managedRoutesCollector struct{}
+
+var (
+	managedRoutesDesc = prometheus.NewDesc("kube_bt_sync_managed_routes", "已同步到宝塔的路由数量", []string{"kind"}, nil)
+	managedHostsDesc  = prometheus.NewDesc("kube_bt_sync_managed_hosts", "已同步到宝塔的域名数量", nil, nil)
+)
+
+func (managedRoutesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- managedRoutesDesc
+	ch <- managedHostsDesc
+}
+
+func (managedRoutesCollector) Collect(ch chan<- prometheus.Metric) {
+	routes := map[string]map[string]bool{KindIngress: {}, KindHTTPRoute: {}, KindEdgeRoute: {}}
+	cacheMutex.RLock()
+	hosts := len(syncedCache)
+	for _, record := range syncedCache {
+		kind := normalizeKind(record.Kind)
+		if routes[kind] == nil {
+			routes[kind] = make(map[string]bool)
+		}
+		routes[kind][record.Namespace+"/"+record.Ingress] = true
+	}
+	cacheMutex.RUnlock()
+
+	for kind, names := range routes {
+		ch <- prometheus.MustNewConstMetric(managedRoutesDesc, prometheus.GaugeValue, float64(len(names)), kind)
+	}
+	ch <- prometheus.MustNewConstMetric(managedHostsDesc, prometheus.GaugeValue, float64(hosts))
+}
+
+// observeSync 记录一次域名对账的结果与耗时
+func observeSync(host string, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	syncAttempts.WithLabelValues(host, result).Inc()
+	syncDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+}
+
+// forgetHostMetrics 域名不再由本工具管理后删除其按域名的指标，避免标签基数随历史域名无限增长
+func forgetHostMetrics(host string) {
+	syncAttempts.DeletePartialMatch(prometheus.Labels{"host": host})
+}
+
+// baotaAction 把 "/site?action=AddSite" 归一为 "site/AddSite"，作为指标的 action 标签
+func baotaAction(apiPath string) string {
+	path, query, _ := strings.Cut(strings.TrimPrefix(apiPath, "/"), "?")
+	for _, kv := range strings.Split(query, "&") {
+		if action, ok := strings.CutPrefix(kv, "action="); ok {
+			return path + "/" + action
+		}
+	}
+	return path
+}
+
+// observeDDNSCheck 系统检测完成后记录 DDNS 域名的解析与端口连通结果
+func observeDDNSCheck(resolved bool, ports map[string]bool) {
+	ddnsResolved.Set(boolToFloat(resolved))
+	for port, ok := range ports {
+		ddnsPortReachable.WithLabelValues(port).Set(boolToFloat(ok))
+	}
+	ddnsCheckTime.SetToCurrentTime()
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,68 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestBaotaAction(t *testing.T) {
+	cases := map[string]string{
+		"/site?action=AddSite":                "site/AddSite",
+		"site?action=AddSite":                 "site/AddSite",
+		"/system?action=ServiceAdmin":         "system/ServiceAdmin",
+		"/site?type=1&action=GetProxyList":    "site/GetProxyList",
+		"/data?action=getData&table=sites":    "data/getData",
+		"/config?action=get_token&action=foo": "config/get_token",
+		"/ajax":                               "ajax",
+		"/ajax?tojs=1":                        "ajax",
+	}
+	for path, want := range cases {
+		if got := baotaAction(path); got != want {
+			t.Errorf("baotaAction(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+// baotaAPIObservations 读取某个接口在耗时直方图中的样本数
+func baotaAPIObservations(t *testing.T, action string) uint64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range families {
+		if mf.GetName() != "kube_bt_sync_baota_api_duration_seconds" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if label.GetName() == "action" && label.GetValue() == action {
+					return m.GetHistogram().GetSampleCount()
+				}
+			}
+		}
+	}
+	return 0
+}
+
+func TestCallBaotaAPIObservesDurationOnTransportError(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close() // 连接会被拒绝
+
+	const action = "test/TransportError"
+	before := baotaAPIObservations(t, action)
+	errorsBefore := testutil.ToFloat64(baotaAPIErrors.WithLabelValues(action, "transport"))
+	if _, err := CallBaotaAPI(Config{BaotaURL: server.URL}, "/test?action=TransportError", nil); err == nil {
+		t.Fatal("连接被拒绝时应返回错误")
+	}
+	if got := baotaAPIObservations(t, action) - before; got != 1 {
+		t.Errorf("传输错误时耗时样本数增加 %d，期望 1", got)
+	}
+	if got := testutil.ToFloat64(baotaAPIErrors.WithLabelValues(action, "transport")) - errorsBefore; got != 1 {
+		t.Errorf("传输错误计数增加 %v，期望 1", got)
+	}
+}
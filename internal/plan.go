@@ -0,0 +1,251 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// 计划中的动作类型
+const (
+	PlanActionCreate        = "create"         // 创建站点与反代
+	PlanActionUpdate        = "update"         // 修改已有反代
+	PlanActionDeleteProxy   = "delete-proxy"   // 移除反代规则
+	PlanActionDeleteSite    = "delete-site"    // 删除宝塔站点
+	PlanActionRetain        = "retain"         // 解除管理但保留宝塔端
+	PlanActionSkipCleanup   = "skip-cleanup"   // 跳过清理直接放行删除
+	PlanActionDeleteIngress = "delete-ingress" // 反向删除 K8s Ingress
+	PlanActionReport        = "report"         // 仅报告，不做任何修改
+)
+
+// PlannedAction 同步引擎将要执行的一个动作
+type PlannedAction struct {
+	Action  string `json:"action"`
+	Domain  string `json:"domain"`
+	Ingress string `json:"ingress"`
+	Target  string `json:"target,omitempty"`
+	Reason  string `json:"reason"`
+}
+
+// Plan /api/plan 的返回结果
+type Plan struct {
+	DryRun      bool            `json:"dryRun"`
+	GeneratedAt string          `json:"generatedAt"`
+	Actions     []PlannedAction `json:"actions"`
+	Warnings    []string        `json:"warnings"`
+}
+
+// dry-run 模式下每个域名最近一次输出的计划，避免重复事件刷屏
+var lastDryRunPlan = make(map[string]string)
+var dryRunMutex sync.Mutex
+
+// planHost 计算 reconcileHost 对单个域名会执行的动作 (不含需要访问宝塔的深度巡检与漂移检测)
+func planHost(cfg Config, host string, ingresses []networkingv1.Ingress, targets map[string]ProxyTarget) []PlannedAction {
+	var actions []PlannedAction
+
+	released := false
+	for _, ing := range ingresses {
+		if !hasCleanupFinalizer(ing) || needsCleanupFinalizer(cfg, ing) || !declaresHost(ing, host) {
+			continue
+		}
+		released = true
+		owner := ing.Namespace + "/" + ing.Name
+		// dry-run 模式下 finalizer 不会被放行，Ingress 保持 Terminating，关闭 dry-run 后才会清理
+		suffix := ""
+		if cfg.DryRun {
+			suffix = " (dry-run：保留 finalizer，Ingress 保持 Terminating)"
+		}
+		if _, stillWanted := targets[host]; stillWanted {
+			if cfg.DryRun {
+				actions = append(actions, PlannedAction{Action: PlanActionReport, Domain: host, Ingress: owner, Reason: "Ingress 删除中，域名已被其它 Ingress 接管" + suffix})
+			}
+			continue
+		}
+		if ing.Annotations[skipCleanupAnnotation] == "true" {
+			actions = append(actions, PlannedAction{Action: PlanActionSkipCleanup, Domain: host, Ingress: owner, Reason: "Ingress 设置了 " + skipCleanupAnnotation + suffix})
+		} else {
+			actions = append(actions, PlannedAction{Action: parseDeletionPolicy(ing), Domain: host, Ingress: owner, Reason: "Ingress 删除中，等待 finalizer 清理" + suffix})
+		}
+	}
+
+	target, wanted := targets[host]
+
+	cacheMutex.RLock()
+	record, exists := syncedCache[host]
+	cacheMutex.RUnlock()
+
+	if !wanted {
+		if exists && !released {
+			policy := record.DeletionPolicy
+			if policy == "" {
+				policy = DeletionPolicyRetain
+			}
+			actions = append(actions, PlannedAction{Action: policy, Domain: host, Ingress: record.Namespace + "/" + record.Ingress, Reason: "域名已不再被任何 Ingress 声明"})
+		}
+		return actions
+	}
+
+	owner := target.Namespace + "/" + target.Ingress
+	switch {
+	case target.ConfigError != "":
+		actions = append(actions, PlannedAction{Action: PlanActionReport, Domain: host, Ingress: owner, Reason: "注解无效，跳过同步: " + target.ConfigError})
+	case !exists:
+		actions = append(actions, PlannedAction{Action: PlanActionCreate, Domain: host, Ingress: owner, Target: target.TargetURL, Reason: "尚未同步到宝塔"})
+	case record.ConfigHash == "":
+		actions = append(actions, PlannedAction{Action: PlanActionUpdate, Domain: host, Ingress: owner, Target: target.TargetURL, Reason: "宝塔端配置漂移，等待修复"})
+	case record.ConfigHash != target.configHash():
+		actions = append(actions, PlannedAction{Action: PlanActionUpdate, Domain: host, Ingress: owner, Target: target.TargetURL, Reason: fmt.Sprintf("反代目标由 %s 变更", record.TargetURL)})
+	}
+	return actions
+}
+
+// logDryRunPlan dry-run 模式下只记录将要执行的动作，不做任何修改
+func logDryRunPlan(host string, actions []PlannedAction) {
+	var parts []string
+	for _, a := range actions {
+		parts = append(parts, fmt.Sprintf("%s (%s)", a.Action, a.Reason))
+	}
+	summary := strings.Join(parts, "；")
+
+	dryRunMutex.Lock()
+	unchanged := lastDryRunPlan[host] == summary
+	lastDryRunPlan[host] = summary
+	dryRunMutex.Unlock()
+	if unchanged || summary == "" {
+		return
+	}
+
+	owner := ""
+	if len(actions) > 0 {
+		owner = actions[0].Ingress
+	}
+	slog.Info("[dry-run] 计划执行", "host", host, "action", "dry-run", "plan", summary)
+	recordHistoryNote(host, owner, "dry-run", "将执行: "+summary)
+}
+
+// BuildPlan 计算同步引擎当前会对宝塔 (以及 K8s Ingress) 执行的全部动作，但不执行
+func BuildPlan(clientset *kubernetes.Clientset, cfg Config) (Plan, error) {
+	plan := Plan{DryRun: cfg.DryRun, GeneratedAt: time.Now().Format("2006-01-02 15:04:05"), Actions: []PlannedAction{}, Warnings: []string{}}
+	if !IsLeader() {
+		refreshSyncState(clientset, cfg)
+	}
+
+	ingresses, err := listRoutes(clientset, cfg)
+	if err != nil {
+		return plan, fmt.Errorf("获取 Ingress 列表失败: %w", err)
+	}
+	targets := collectTargets(cfg, ingresses)
+
+	// 与深度巡检一致：拉取宝塔站点列表，找出已同步但宝塔端缺失的域名
+	baotaSites, listErr := listBaotaSites(cfg)
+	if listErr != nil {
+		plan.Warnings = append(plan.Warnings, "无法获取宝塔站点列表，跳过缺失与漂移检测: "+listErr.Error())
+	}
+
+	hosts := make(map[string]bool)
+	for host := range targets {
+		hosts[host] = true
+	}
+	cacheMutex.RLock()
+	for host := range syncedCache {
+		hosts[host] = true
+	}
+	cacheMutex.RUnlock()
+	for _, ing := range ingresses {
+		if hasCleanupFinalizer(ing) {
+			for _, rule := range ing.Spec.Rules {
+				if rule.Host != "" {
+					hosts[rule.Host] = true
+				}
+			}
+		}
+	}
+
+	for host := range hosts {
+		target, wanted := targets[host]
+		cacheMutex.RLock()
+		record, exists := syncedCache[host]
+		count := missingCounts[host]
+		cacheMutex.RUnlock()
+
+		if wanted && exists && listErr == nil && !baotaSites[host] {
+			plan.Actions = append(plan.Actions, planMissingSite(cfg, target, count))
+			continue
+		}
+
+		actions := planHost(cfg, host, ingresses, targets)
+		if len(actions) == 0 && wanted && exists && listErr == nil {
+			changes, err := detectProxyDrift(cfg, host, record)
+			if err != nil {
+				plan.Warnings = append(plan.Warnings, fmt.Sprintf("[%s] 漂移检测失败: %v", host, err))
+			} else if len(changes) > 0 {
+				actions = append(actions, PlannedAction{Action: PlanActionUpdate, Domain: host, Ingress: target.Namespace + "/" + target.Ingress, Target: target.TargetURL, Reason: strings.Join(changes, "；")})
+			}
+		}
+		plan.Actions = append(plan.Actions, actions...)
+	}
+
+	sort.Slice(plan.Actions, func(i, j int) bool {
+		if plan.Actions[i].Domain != plan.Actions[j].Domain {
+			return plan.Actions[i].Domain < plan.Actions[j].Domain
+		}
+		return plan.Actions[i].Action < plan.Actions[j].Action
+	})
+	return plan, nil
+}
+
+// planMissingSite 按 MISSING_SITE_POLICY 推演宝塔端缺失站点的处理方式
+func planMissingSite(cfg Config, target ProxyTarget, count int) PlannedAction {
+	action := PlannedAction{Domain: target.Domain, Ingress: target.Namespace + "/" + target.Ingress, Target: target.TargetURL}
+	switch cfg.MissingSitePolicy {
+	case MissingSitePolicyReport:
+		action.Action, action.Reason = PlanActionReport, "宝塔端站点缺失 (策略 report)"
+	case MissingSitePolicyDeleteIngress:
+		if count+1 >= cfg.MissingSiteConfirmations {
+			action.Action, action.Reason = PlanActionDeleteIngress, fmt.Sprintf("宝塔端站点连续缺失 %d 次", count+1)
+		} else {
+			action.Action, action.Reason = PlanActionReport, fmt.Sprintf("宝塔端站点缺失，确认 %d/%d", count+1, cfg.MissingSiteConfirmations)
+		}
+	default:
+		action.Action, action.Reason = PlanActionCreate, "宝塔端站点缺失，将重新创建"
+	}
+	return action
+}
+
+// listBaotaSites 获取宝塔端全部站点名称
+// 响应中没有 data 数组 (例如 {"status":false,"msg":"..."}) 时返回错误，
+// 否则空列表会被当成“所有站点都已缺失”，进而触发重建或反向删除
+func listBaotaSites(cfg Config) (map[string]bool, error) {
+	resp, err := CallBaotaAPI(cfg, "/data?action=getData", map[string]string{"table": "sites", "limit": "1000"})
+	if err != nil {
+		return nil, err
+	}
+	var res struct {
+		Status *bool  `json:"status"`
+		Msg    string `json:"msg"`
+		Data   *[]struct {
+			Name string `json:"name"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(resp), &res); err != nil {
+		return nil, fmt.Errorf("解析宝塔站点列表失败: %s", resp)
+	}
+	if res.Status != nil && !*res.Status {
+		return nil, fmt.Errorf("获取宝塔站点列表失败: %s", res.Msg)
+	}
+	if res.Data == nil {
+		return nil, fmt.Errorf("宝塔站点列表缺少 data 字段: %s", resp)
+	}
+	sites := make(map[string]bool, len(*res.Data))
+	for _, site := range *res.Data {
+		sites[site.Name] = true
+	}
+	return sites, nil
+}
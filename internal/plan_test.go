@@ -0,0 +1,103 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// setSyncedCache 用给定的同步记录替换全局缓存，测试结束后恢复
+func setSyncedCache(t *testing.T, records map[string]SyncRecord) {
+	t.Helper()
+	cacheMutex.Lock()
+	saved := syncedCache
+	syncedCache = records
+	cacheMutex.Unlock()
+	t.Cleanup(func() {
+		cacheMutex.Lock()
+		syncedCache = saved
+		cacheMutex.Unlock()
+	})
+}
+
+func testRoute(name, host string, annotations map[string]string) networkingv1.Ingress {
+	ing := networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Namespace: "app", Name: name, Annotations: annotations}}
+	ing.Spec.Rules = []networkingv1.IngressRule{{Host: host}}
+	return ing
+}
+
+func TestPlanHost(t *testing.T) {
+	cfg := Config{DDNSHost: "home.example.com", DefaultPort: "38333", HTTPSPort: "443"}
+	synced := map[string]string{"kube-bt-sync.io/baota-sync": "true", "kube-bt-sync.io/deletion-policy": DeletionPolicyDeleteSite}
+	deleting := testRoute("old", "gone.example.com", synced)
+	now := metav1.NewTime(time.Now())
+	deleting.DeletionTimestamp = &now
+	deleting.Finalizers = []string{CleanupFinalizer}
+
+	ingresses := []networkingv1.Ingress{
+		testRoute("web", "new.example.com", synced),
+		testRoute("api", "changed.example.com", synced),
+		testRoute("same", "same.example.com", synced),
+		deleting,
+	}
+	targets := collectTargets(cfg, ingresses)
+	setSyncedCache(t, map[string]SyncRecord{
+		"changed.example.com": {Namespace: "app", Ingress: "api", TargetURL: "http://old:1", ConfigHash: "stale"},
+		"same.example.com":    {Namespace: "app", Ingress: "same", TargetURL: targets["same.example.com"].TargetURL, ConfigHash: targets["same.example.com"].configHash()},
+		"removed.example.com": {Namespace: "app", Ingress: "legacy", DeletionPolicy: DeletionPolicyDeleteProxy},
+		"gone.example.com":    {Namespace: "app", Ingress: "old", DeletionPolicy: DeletionPolicyDeleteSite},
+	})
+
+	cases := []struct {
+		host   string
+		dryRun bool
+		want   []string
+	}{
+		{host: "new.example.com", want: []string{PlanActionCreate}},
+		{host: "changed.example.com", want: []string{PlanActionUpdate}},
+		{host: "same.example.com", want: nil},
+		{host: "removed.example.com", want: []string{PlanActionDeleteProxy}},
+		// 删除中的 Ingress 只按 finalizer 清理一次，不会再按同步记录重复清理
+		{host: "gone.example.com", want: []string{PlanActionDeleteSite}},
+		{host: "gone.example.com", dryRun: true, want: []string{PlanActionDeleteSite}},
+	}
+	for _, c := range cases {
+		cfg.DryRun = c.dryRun
+		actions := planHost(cfg, c.host, ingresses, targets)
+		var got []string
+		for _, a := range actions {
+			got = append(got, a.Action)
+		}
+		if len(got) != len(c.want) || (len(got) > 0 && got[0] != c.want[0]) {
+			t.Errorf("planHost(%s, dryRun=%v) = %v, want %v", c.host, c.dryRun, got, c.want)
+		}
+	}
+}
+
+// dry-run 模式下删除中的 Ingress 不会被放行：finalizeIngress 不访问 K8s 与宝塔，计划中注明保持 Terminating
+func TestFinalizeIngressDryRun(t *testing.T) {
+	ing := testRoute("old", "gone.example.com", map[string]string{"kube-bt-sync.io/baota-sync": "true", "kube-bt-sync.io/deletion-policy": DeletionPolicyDeleteSite})
+	now := metav1.NewTime(time.Now())
+	ing.DeletionTimestamp = &now
+	ing.Finalizers = []string{CleanupFinalizer}
+
+	// clientset 为 nil：只要 dry-run 模式下访问了 K8s 就会 panic
+	if err := finalizeIngress(nil, Config{DryRun: true}, ing, nil); err != nil {
+		t.Fatalf("finalizeIngress() error = %v", err)
+	}
+	if err := reconcileFinalizer(nil, Config{DryRun: true}, routeRef{Kind: KindIngress, Namespace: "app", Name: "old"}); err != nil {
+		t.Fatalf("reconcileFinalizer() error = %v", err)
+	}
+
+	setSyncedCache(t, map[string]SyncRecord{})
+	actions := planHost(Config{DryRun: true}, "gone.example.com", []networkingv1.Ingress{ing}, map[string]ProxyTarget{})
+	if len(actions) != 1 || actions[0].Action != PlanActionDeleteSite {
+		t.Fatalf("planHost() = %+v，应列出待执行的 delete-site", actions)
+	}
+	if want := "Terminating"; !strings.Contains(actions[0].Reason, want) {
+		t.Errorf("planHost() reason = %q，应注明 Ingress 保持 %s", actions[0].Reason, want)
+	}
+}
@@ -0,0 +1,216 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// 探测时最多读取的响应体大小，用于比对响应内容与查找 PROBE_EXPECT_BODY
+const probeBodyLimit = 64 * 1024
+
+// ProbeResult 一次端到端探测的结果：经由宝塔服务器访问域名，是否真的到达了我们的 Ingress
+type ProbeResult struct {
+	Time        string `json:"time"`
+	Address     string `json:"address"`              // 实际连接的宝塔服务器地址
+	ResolvedIP  string `json:"resolvedIP,omitempty"` // 通过公共 DNS 解析得到的 IP (开启 PROBE_DNS_SERVER 时)
+	StatusCode  int    `json:"statusCode"`
+	LatencyMs   int64  `json:"latencyMs"`
+	FromIngress bool   `json:"fromIngress"`
+	Error       string `json:"error,omitempty"`
+}
+
+var probeResults = make(map[string]ProbeResult)
+var probeMutex sync.RWMutex
+
+// probeResponse 比对所需的响应信息
+type probeResponse struct {
+	statusCode int
+	location   string
+	body       []byte
+	bodyHash   [sha256.Size]byte
+	latency    time.Duration
+}
+
+// probeClient 不跟随跳转 (HTTPS 跳转本身就是 Ingress 的响应，按跳转目标比对)
+// https 上游以访问域名作为 SNI，探测只比对响应，不校验证书
+func probeClient(host string) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{ServerName: host, InsecureSkipVerify: true}, DisableKeepAlives: true},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error { return http.ErrUseLastResponse },
+	}
+}
+
+// probeAfterSync 同步成功后在后台执行一次探测 (未开启 E2E_PROBE 时不做任何事)
+func probeAfterSync(cfg Config, target ProxyTarget) {
+	if !cfg.ProbeEnabled || cfg.DryRun {
+		return
+	}
+	go ProbeHost(cfg, target.Domain, target.TargetURL, target.Namespace+"/"+target.Ingress)
+}
+
+// ProbeHost 带着域名的 Host 头访问宝塔服务器 (或公共 DNS 解析出的地址)，按 probeVerdict 判断响应是否来自我们的 Ingress
+func ProbeHost(cfg Config, domain, targetURL, owner string) ProbeResult {
+	result := ProbeResult{Time: time.Now().Format("2006-01-02 15:04:05")}
+
+	addr, resolvedIP, err := probeAddress(cfg, domain)
+	result.Address, result.ResolvedIP = addr, resolvedIP
+	if err == nil {
+		var viaBaota probeResponse
+		viaBaota, err = probeRequest(cfg, "http://"+addr, domain)
+		if err == nil {
+			result.StatusCode, result.LatencyMs = viaBaota.statusCode, viaBaota.latency.Milliseconds()
+			err = probeVerdict(cfg, viaBaota, func() (probeResponse, error) { return probeRequest(cfg, targetURL, domain) })
+			result.FromIngress = err == nil
+		}
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	probeMutex.Lock()
+	probeResults[domain] = result
+	probeMutex.Unlock()
+
+	if result.FromIngress {
+		slog.Info("端到端探测通过", "host", domain, "action", "probe", "status", result.StatusCode, "duration", time.Duration(result.LatencyMs)*time.Millisecond)
+		recordHistoryNote(domain, owner, "probe", fmt.Sprintf("HTTP %d，耗时 %dms，响应来自 Ingress", result.StatusCode, result.LatencyMs))
+	} else {
+		slog.Warn("端到端探测未通过", "host", domain, "action", "probe", "error", err)
+		recordHistory(domain, owner, "probe", err)
+	}
+	return result
+}
+
+// probeVerdict 判断经由宝塔的响应是否确实来自我们的 Ingress，不是则返回原因 (fetchDirect 直连 Ingress，最多调用两次)：
+//  1. 配置了 PROBE_EXPECT_STATUS 时状态码必须一致
+//  2. 配置了 PROBE_EXPECT_BODY 时以响应体中的该标识为准，不再直连对照
+//  3. 否则与直连 Ingress 的响应比对：都是跳转时比对跳转目标 (Ingress 的强制 HTTPS 可能返回 308)，
+//     其余情况状态码与响应体都必须一致；响应体不一致时再直连一次，两次直连的响应体也不同说明页面是动态的，
+//     此时只能退化为比对状态码 (宝塔默认页、Nginx 404 页面等静态页面不会被误判为来自 Ingress)
+func probeVerdict(cfg Config, viaBaota probeResponse, fetchDirect func() (probeResponse, error)) error {
+	if cfg.ProbeExpectStatus != 0 && viaBaota.statusCode != cfg.ProbeExpectStatus {
+		return fmt.Errorf("状态码 %d 与 PROBE_EXPECT_STATUS=%d 不一致", viaBaota.statusCode, cfg.ProbeExpectStatus)
+	}
+	if cfg.ProbeExpectBody != "" {
+		if !bytes.Contains(viaBaota.body, []byte(cfg.ProbeExpectBody)) {
+			return fmt.Errorf("响应中未找到 PROBE_EXPECT_BODY 指定的内容")
+		}
+		return nil
+	}
+
+	direct, err := fetchDirect()
+	if err != nil {
+		return fmt.Errorf("直连 Ingress 对照失败: %w", err)
+	}
+	if isProbeRedirect(viaBaota.statusCode) && isProbeRedirect(direct.statusCode) {
+		if viaBaota.location != direct.location {
+			return fmt.Errorf("跳转目标与直连 Ingress 不一致 (宝塔 %s / Ingress %s)", viaBaota.location, direct.location)
+		}
+		return nil
+	}
+	if cfg.ProbeExpectStatus == 0 && viaBaota.statusCode != direct.statusCode {
+		return fmt.Errorf("响应与直连 Ingress 不一致 (宝塔 %d / Ingress %d)", viaBaota.statusCode, direct.statusCode)
+	}
+	if viaBaota.bodyHash == direct.bodyHash {
+		return nil
+	}
+	again, err := fetchDirect()
+	if err != nil {
+		return fmt.Errorf("直连 Ingress 对照失败: %w", err)
+	}
+	if again.bodyHash == direct.bodyHash {
+		return fmt.Errorf("响应内容与直连 Ingress 不一致 (可能是宝塔默认页或其它站点)，HTTP %d", viaBaota.statusCode)
+	}
+	return nil
+}
+
+func isProbeRedirect(code int) bool {
+	return code >= 300 && code < 400
+}
+
+// GetProbeResult 返回域名最近一次的探测结果
+func GetProbeResult(domain string) (ProbeResult, bool) {
+	probeMutex.RLock()
+	defer probeMutex.RUnlock()
+	result, ok := probeResults[domain]
+	return result, ok
+}
+
+// probeAddress 计算探测要连接的地址：默认为 PROBE_ADDR (未填写时取宝塔面板所在主机的 80 端口)
+// 配置了 PROBE_DNS_SERVER 时改为通过该公共 DNS 解析域名，顺带验证 DNS 是否指向宝塔服务器
+func probeAddress(cfg Config, domain string) (addr string, resolvedIP string, err error) {
+	if cfg.ProbeDNSServer == "" {
+		if cfg.ProbeAddr != "" {
+			return cfg.ProbeAddr, "", nil
+		}
+		u, err := url.Parse(cfg.BaotaURL)
+		if err != nil || u.Hostname() == "" {
+			return "", "", fmt.Errorf("无法从 BAOTA_URL 推断宝塔服务器地址，请配置 PROBE_ADDR")
+		}
+		return net.JoinHostPort(u.Hostname(), "80"), "", nil
+	}
+
+	dnsServer := cfg.ProbeDNSServer
+	if _, _, splitErr := net.SplitHostPort(dnsServer); splitErr != nil {
+		dnsServer = net.JoinHostPort(dnsServer, "53")
+	}
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			d := net.Dialer{Timeout: cfg.ProbeTimeout}
+			return d.DialContext(ctx, network, dnsServer)
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ProbeTimeout)
+	defer cancel()
+	ips, err := resolver.LookupHost(ctx, domain)
+	if err != nil {
+		return "", "", fmt.Errorf("公共 DNS (%s) 解析失败: %w", cfg.ProbeDNSServer, err)
+	}
+	if len(ips) == 0 {
+		return "", "", fmt.Errorf("公共 DNS (%s) 未返回任何记录", cfg.ProbeDNSServer)
+	}
+	return net.JoinHostPort(ips[0], "80"), ips[0], nil
+}
+
+// probeRequest 以指定的 Host 头请求 baseURL + PROBE_PATH
+func probeRequest(cfg Config, baseURL, host string) (probeResponse, error) {
+	var res probeResponse
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ProbeTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", baseURL+cfg.ProbePath, nil)
+	if err != nil {
+		return res, err
+	}
+	req.Host = host
+	req.Header.Set("User-Agent", "kube-bt-sync-probe")
+
+	start := time.Now()
+	resp, err := probeClient(host).Do(req)
+	if err != nil {
+		return res, err
+	}
+	defer resp.Body.Close()
+
+	var body bytes.Buffer
+	if _, err := io.Copy(&body, io.LimitReader(resp.Body, probeBodyLimit)); err != nil {
+		return res, err
+	}
+	res.latency = time.Since(start)
+	res.statusCode = resp.StatusCode
+	res.location = resp.Header.Get("Location")
+	res.body = body.Bytes()
+	res.bodyHash = sha256.Sum256(res.body)
+	return res, nil
+}
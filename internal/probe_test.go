@@ -0,0 +1,82 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testProbeResponse(status int, location, body string) probeResponse {
+	return probeResponse{statusCode: status, location: location, body: []byte(body), bodyHash: sha256.Sum256([]byte(body))}
+}
+
+func TestProbeVerdict(t *testing.T) {
+	app := testProbeResponse(200, "", "<h1>my app</h1>")
+	baotaDefault := testProbeResponse(200, "", "<h1>恭喜，站点创建成功！</h1>")
+	notFound := testProbeResponse(404, "", "<center>nginx</center>")
+
+	cases := []struct {
+		name     string
+		cfg      Config
+		viaBaota probeResponse
+		direct   []probeResponse // 依次返回的直连响应
+		wantOK   bool
+	}{
+		{name: "响应一致", viaBaota: app, direct: []probeResponse{app}, wantOK: true},
+		{name: "宝塔默认页", viaBaota: baotaDefault, direct: []probeResponse{app, app}, wantOK: false},
+		{name: "Nginx 404 页面与 Ingress 的 404 不同", viaBaota: notFound, direct: []probeResponse{testProbeResponse(404, "", "default backend - 404"), testProbeResponse(404, "", "default backend - 404")}, wantOK: false},
+		{name: "状态码不一致", viaBaota: notFound, direct: []probeResponse{app}, wantOK: false},
+		{name: "动态页面退化为比对状态码", viaBaota: testProbeResponse(200, "", "time=1"), direct: []probeResponse{testProbeResponse(200, "", "time=2"), testProbeResponse(200, "", "time=3")}, wantOK: true},
+		{name: "强制 HTTPS 跳转目标一致", viaBaota: testProbeResponse(301, "https://a.example.com/", ""), direct: []probeResponse{testProbeResponse(308, "https://a.example.com/", "")}, wantOK: true},
+		{name: "跳转到其它地址", viaBaota: testProbeResponse(302, "https://other.example.com/", ""), direct: []probeResponse{testProbeResponse(308, "https://a.example.com/", "")}, wantOK: false},
+		{name: "期望的标识存在", cfg: Config{ProbeExpectBody: "my app"}, viaBaota: app, wantOK: true},
+		{name: "期望的标识不存在", cfg: Config{ProbeExpectBody: "my app"}, viaBaota: baotaDefault, wantOK: false},
+		{name: "期望的状态码不一致", cfg: Config{ProbeExpectStatus: 200}, viaBaota: notFound, wantOK: false},
+		{name: "期望的状态码一致但内容来自宝塔", cfg: Config{ProbeExpectStatus: 200}, viaBaota: baotaDefault, direct: []probeResponse{app, app}, wantOK: false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			calls := 0
+			fetch := func() (probeResponse, error) {
+				if calls >= len(c.direct) {
+					return probeResponse{}, errors.New("不应再直连 Ingress")
+				}
+				calls++
+				return c.direct[calls-1], nil
+			}
+			err := probeVerdict(c.cfg, c.viaBaota, fetch)
+			if (err == nil) != c.wantOK {
+				t.Errorf("probeVerdict() error = %v, wantOK %v", err, c.wantOK)
+			}
+		})
+	}
+}
+
+// 域名尚未真正反代到 Ingress 时，宝塔返回的是自己的默认站点页面，不能判定为通过
+func TestProbeHostBaotaDefaultPage(t *testing.T) {
+	baota := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html><body><h1>恭喜，站点创建成功！</h1></body></html>")
+	}))
+	defer baota.Close()
+	ingress := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html><body>my app</body></html>")
+	}))
+	defer ingress.Close()
+
+	cfg := Config{ProbeAddr: strings.TrimPrefix(baota.URL, "http://"), ProbePath: "/", ProbeTimeout: 5 * time.Second}
+	result := ProbeHost(cfg, "probe-default.example.com", ingress.URL, "app/web")
+	if result.FromIngress {
+		t.Fatalf("宝塔默认页被判定为来自 Ingress: %+v", result)
+	}
+
+	// 宝塔真正反代到 Ingress 后通过
+	cfg.ProbeAddr = strings.TrimPrefix(ingress.URL, "http://")
+	if result := ProbeHost(cfg, "probe-default.example.com", ingress.URL, "app/web"); !result.FromIngress {
+		t.Fatalf("反代到 Ingress 后探测仍未通过: %+v", result)
+	}
+}
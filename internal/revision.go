@@ -0,0 +1,262 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// 路由修订记录：控制台每次下发 / 回滚都保存一份完整 YAML，可以对比任意两个修订并一键回滚
+// 记录保存在 REVISION_CONFIGMAP 中，每条路由一个 key；Web 控制台在所有副本上运行，写入依赖 resourceVersion 乐观并发
+
+const (
+	RevisionActionBaseline = "baseline" // 第一次经由控制台修改前，集群中已有的版本
+	RevisionActionApply    = "apply"
+	RevisionActionRollback = "rollback"
+)
+
+// 所有路由的修订共用一个 ConfigMap，上限为 1MiB，留出余量；超出时跨路由丢弃最旧的修订
+const revisionMaxBytes = 900 * 1024
+
+// RouteRevision 路由的一个修订
+type RouteRevision struct {
+	Revision int    `json:"revision"`
+	Time     string `json:"time"`
+	Author   string `json:"author"`
+	Action   string `json:"action"`
+	Note     string `json:"note,omitempty"`
+	YAML     string `json:"yaml"`
+}
+
+// DiffLine 修订对比中的一行：" " 未变化 / "-" 仅存在于旧修订 / "+" 仅存在于新修订
+type DiffLine struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// appliedRoute 一次下发落地的路由，Previous 为下发前集群中的 YAML (新建时为空)
+type appliedRoute struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Previous  string
+}
+
+// revisionKey ConfigMap 的 key 只允许字母数字与 "-._"，命名空间不含 "."，拼接后不会产生歧义
+func revisionKey(kind, ns, name string) string {
+	return strings.ToLower(kind) + "." + ns + "." + name
+}
+
+// loadRevisions 按修订号升序返回路由的全部修订，尚无记录时返回空
+func loadRevisions(clientset *kubernetes.Clientset, cfg Config, kind, ns, name string) ([]RouteRevision, error) {
+	cm, err := clientset.CoreV1().ConfigMaps(cfg.PodNamespace).Get(context.TODO(), cfg.RevisionConfigMap, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeRevisions(cm, revisionKey(kind, ns, name))
+}
+
+func decodeRevisions(cm *corev1.ConfigMap, key string) ([]RouteRevision, error) {
+	raw, ok := cm.Data[key]
+	if !ok {
+		return nil, nil
+	}
+	var revisions []RouteRevision
+	if err := json.Unmarshal([]byte(raw), &revisions); err != nil {
+		return nil, fmt.Errorf("修订记录 %s 内容损坏: %w", key, err)
+	}
+	return revisions, nil
+}
+
+// findRevision 按修订号查找
+func findRevision(revisions []RouteRevision, number int) (RouteRevision, bool) {
+	for _, rev := range revisions {
+		if rev.Revision == number {
+			return rev, true
+		}
+	}
+	return RouteRevision{}, false
+}
+
+// recordRevision 下发成功后追加一个修订；该路由还没有任何修订时，先把下发前的版本记为 baseline，保证能回滚到控制台接管之前
+// 超出 REVISION_LIMIT 时丢弃最旧的修订
+func recordRevision(clientset *kubernetes.Clientset, cfg Config, applied appliedRoute, author, action, note, content string) (RouteRevision, error) {
+	key := revisionKey(applied.Kind, applied.Namespace, applied.Name)
+	now := time.Now().Format("2006-01-02 15:04:05")
+	var saved RouteRevision
+
+	client := clientset.CoreV1().ConfigMaps(cfg.PodNamespace)
+	retriable := func(err error) bool { return apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err) }
+	err := retry.OnError(retry.DefaultRetry, retriable, func() error {
+		cm, err := client.Get(context.TODO(), cfg.RevisionConfigMap, metav1.GetOptions{})
+		notFound := apierrors.IsNotFound(err)
+		if notFound {
+			cm = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      cfg.RevisionConfigMap,
+					Namespace: cfg.PodNamespace,
+					Labels:    map[string]string{"app.kubernetes.io/managed-by": "kube-bt-sync"},
+				},
+			}
+		} else if err != nil {
+			return err
+		}
+
+		revisions, err := decodeRevisions(cm, key)
+		if err != nil {
+			return err
+		}
+		if len(revisions) == 0 && applied.Previous != "" {
+			revisions = append(revisions, RouteRevision{Revision: 1, Time: now, Author: "-", Action: RevisionActionBaseline, YAML: applied.Previous})
+		}
+		next := 1
+		if len(revisions) > 0 {
+			next = revisions[len(revisions)-1].Revision + 1
+		}
+		saved = RouteRevision{Revision: next, Time: now, Author: author, Action: action, Note: note, YAML: content}
+		revisions = append(revisions, saved)
+		if len(revisions) > cfg.RevisionLimit {
+			revisions = revisions[len(revisions)-cfg.RevisionLimit:]
+		}
+
+		data, err := json.Marshal(revisions)
+		if err != nil {
+			return err
+		}
+		if cm.Data == nil {
+			cm.Data = make(map[string]string)
+		}
+		cm.Data[key] = string(data)
+		if err := trimRevisions(cm, key); err != nil {
+			return err
+		}
+		if notFound {
+			_, err = client.Create(context.TODO(), cm, metav1.CreateOptions{})
+		} else {
+			_, err = client.Update(context.TODO(), cm, metav1.UpdateOptions{})
+		}
+		return err
+	})
+	if err != nil {
+		slog.Warn("保存修订记录失败", "kind", applied.Kind, "namespace", applied.Namespace, "ingress", applied.Name, "error", err)
+		return RouteRevision{}, err
+	}
+	slog.Info("已记录修订", "kind", applied.Kind, "namespace", applied.Namespace, "ingress", applied.Name, "revision", saved.Revision, "action", action, "actor", author)
+	return saved, nil
+}
+
+// trimRevisions ConfigMap 超出 revisionMaxBytes 时按时间丢弃最旧的修订 (可以来自任意路由)
+// 每条路由至少保留最新的一个修订，全部只剩一个修订仍然超出时，丢弃最久未修改的其它路由
+// 刚写入的 keep 对应的路由最后处理，仍然放不下时返回错误
+func trimRevisions(cm *corev1.ConfigMap, keep string) error {
+	size := func() int {
+		total := 0
+		for k, v := range cm.Data {
+			total += len(k) + len(v)
+		}
+		return total
+	}
+	if size() <= revisionMaxBytes {
+		return nil
+	}
+
+	all := make(map[string][]RouteRevision, len(cm.Data))
+	for k := range cm.Data {
+		revisions, err := decodeRevisions(cm, k)
+		if err != nil {
+			// 内容损坏的记录无法回滚，优先丢弃
+			delete(cm.Data, k)
+			continue
+		}
+		all[k] = revisions
+	}
+
+	for size() > revisionMaxBytes {
+		// 找出最旧的可丢弃修订：优先丢弃仍有多个修订的路由中最旧的一个
+		victim, oldest, whole := "", "", false
+		for k, revisions := range all {
+			if len(revisions) == 0 || (k == keep && len(revisions) == 1) {
+				continue
+			}
+			single := len(revisions) == 1
+			if victim != "" && single && !whole {
+				continue
+			}
+			if victim == "" || (whole && !single) || revisions[0].Time < oldest {
+				victim, oldest, whole = k, revisions[0].Time, single
+			}
+		}
+		if victim == "" {
+			return fmt.Errorf("修订记录超出 ConfigMap 容量上限 (%d 字节)", revisionMaxBytes)
+		}
+
+		if whole {
+			delete(all, victim)
+			delete(cm.Data, victim)
+			continue
+		}
+		all[victim] = all[victim][1:]
+		data, err := json.Marshal(all[victim])
+		if err != nil {
+			return err
+		}
+		cm.Data[victim] = string(data)
+	}
+	return nil
+}
+
+// diffLines 基于最长公共子序列的逐行对比，YAML 通常只有几十行，O(n*m) 足够
+func diffLines(from, to string) []DiffLine {
+	a := strings.Split(strings.TrimRight(from, "\n"), "\n")
+	b := strings.Split(strings.TrimRight(to, "\n"), "\n")
+
+	// lcs[i][j] 为 a[i:] 与 b[j:] 的最长公共子序列长度
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var lines []DiffLine
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, DiffLine{Op: " ", Text: a[i]})
+			i, j = i+1, j+1
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, DiffLine{Op: "-", Text: a[i]})
+			i++
+		default:
+			lines = append(lines, DiffLine{Op: "+", Text: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, DiffLine{Op: "-", Text: a[i]})
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, DiffLine{Op: "+", Text: b[j]})
+	}
+	return lines
+}
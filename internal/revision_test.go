@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// revisionsData 生成一条路由的修订记录，每个修订的 YAML 约 size 字节，时间依次为 times
+func revisionsData(t *testing.T, size int, times ...string) string {
+	t.Helper()
+	var revisions []RouteRevision
+	for i, at := range times {
+		revisions = append(revisions, RouteRevision{Revision: i + 1, Time: at, Action: "apply", YAML: strings.Repeat("x", size)})
+	}
+	data, err := json.Marshal(revisions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func revisionCount(t *testing.T, cm *corev1.ConfigMap, key string) int {
+	t.Helper()
+	revisions, err := decodeRevisions(cm, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(revisions)
+}
+
+func TestTrimRevisions(t *testing.T) {
+	const kb = 1024
+
+	t.Run("未超出上限时不做改动", func(t *testing.T) {
+		cm := &corev1.ConfigMap{Data: map[string]string{"a": revisionsData(t, kb, "2026-01-01 00:00:00", "2026-01-02 00:00:00")}}
+		if err := trimRevisions(cm, "a"); err != nil {
+			t.Fatal(err)
+		}
+		if n := revisionCount(t, cm, "a"); n != 2 {
+			t.Errorf("a 剩余 %d 个修订", n)
+		}
+	})
+
+	t.Run("优先丢弃多修订路由中最旧的修订", func(t *testing.T) {
+		cm := &corev1.ConfigMap{Data: map[string]string{
+			"a": revisionsData(t, 200*kb, "2026-01-01 00:00:00", "2026-01-05 00:00:00", "2026-01-06 00:00:00"),
+			"b": revisionsData(t, 200*kb, "2026-01-02 00:00:00", "2026-01-07 00:00:00"),
+		}}
+		if err := trimRevisions(cm, "b"); err != nil {
+			t.Fatal(err)
+		}
+		if a, b := revisionCount(t, cm, "a"), revisionCount(t, cm, "b"); a != 2 || b != 2 {
+			t.Errorf("剩余修订 a=%d b=%d，期望各 2 个", a, b)
+		}
+	})
+
+	t.Run("都只剩一个修订时丢弃最久未修改的其它路由", func(t *testing.T) {
+		cm := &corev1.ConfigMap{Data: map[string]string{
+			"old":  revisionsData(t, 400*kb, "2026-01-01 00:00:00"),
+			"new":  revisionsData(t, 400*kb, "2026-01-03 00:00:00"),
+			"keep": revisionsData(t, 300*kb, "2026-01-02 00:00:00"),
+		}}
+		if err := trimRevisions(cm, "keep"); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := cm.Data["old"]; ok {
+			t.Error("最久未修改的路由应被丢弃")
+		}
+		if revisionCount(t, cm, "new") != 1 || revisionCount(t, cm, "keep") != 1 {
+			t.Errorf("剩余 %v", cm.Data)
+		}
+	})
+
+	t.Run("内容损坏的记录优先丢弃", func(t *testing.T) {
+		cm := &corev1.ConfigMap{Data: map[string]string{
+			"broken": "{" + strings.Repeat("x", 500*kb),
+			"a":      revisionsData(t, 200*kb, "2026-01-01 00:00:00", "2026-01-02 00:00:00"),
+		}}
+		if err := trimRevisions(cm, "a"); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := cm.Data["broken"]; ok {
+			t.Error("损坏的记录应被丢弃")
+		}
+		if n := revisionCount(t, cm, "a"); n != 2 {
+			t.Errorf("a 剩余 %d 个修订", n)
+		}
+	})
+
+	t.Run("刚写入的修订本身放不下时返回错误", func(t *testing.T) {
+		cm := &corev1.ConfigMap{Data: map[string]string{"a": revisionsData(t, revisionMaxBytes, "2026-01-01 00:00:00")}}
+		err := trimRevisions(cm, "a")
+		if err == nil || !strings.Contains(err.Error(), fmt.Sprint(revisionMaxBytes)) {
+			t.Fatalf("err = %v", err)
+		}
+	})
+}
@@ -0,0 +1,191 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// rfc2136Provider 通过 RFC2136 动态更新 (可选 TSIG 签名) 维护记录，适用于 BIND、PowerDNS、Knot 等自建权威 DNS
+type rfc2136Provider struct {
+	server    string
+	zone      string
+	owner     string // 归属标记 TXT 记录的内容
+	keyName   string
+	secret    string
+	algorithm string
+	timeout   time.Duration
+	send      func(*dns.Msg) error // 发送更新请求，默认为 exchange
+}
+
+// TSIG 算法名与 miekg/dns 常量的对应关系
+var tsigAlgorithms = map[string]string{
+	"hmac-sha1":   dns.HmacSHA1,
+	"hmac-sha224": dns.HmacSHA224,
+	"hmac-sha256": dns.HmacSHA256,
+	"hmac-sha384": dns.HmacSHA384,
+	"hmac-sha512": dns.HmacSHA512,
+}
+
+func newRFC2136Provider(cfg Config) (*rfc2136Provider, error) {
+	if cfg.RFC2136Server == "" || cfg.RFC2136Zone == "" {
+		return nil, fmt.Errorf("必须配置 RFC2136_SERVER 与 RFC2136_ZONE")
+	}
+	server := cfg.RFC2136Server
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	p := &rfc2136Provider{server: server, zone: dns.Fqdn(cfg.RFC2136Zone), owner: dnsOwnerMarker(cfg), timeout: 10 * time.Second}
+	p.send = p.exchange
+
+	// 未配置 TSIG 时发送不签名的更新，只适用于按来源 IP 授权的服务器
+	if cfg.RFC2136TSIGKeyName != "" || cfg.RFC2136TSIGSecret != "" {
+		if cfg.RFC2136TSIGKeyName == "" || cfg.RFC2136TSIGSecret == "" {
+			return nil, fmt.Errorf("RFC2136_TSIG_KEY_NAME 与 RFC2136_TSIG_SECRET 必须同时配置")
+		}
+		alg, ok := tsigAlgorithms[strings.ToLower(cfg.RFC2136TSIGAlgorithm)]
+		if !ok {
+			return nil, fmt.Errorf("RFC2136_TSIG_ALGORITHM=%q 不受支持", cfg.RFC2136TSIGAlgorithm)
+		}
+		p.keyName, p.secret, p.algorithm = dns.Fqdn(cfg.RFC2136TSIGKeyName), cfg.RFC2136TSIGSecret, alg
+	}
+	return p, nil
+}
+
+func (p *rfc2136Provider) Name() string {
+	return fmt.Sprintf("%s (%s @ %s)", DNSProviderRFC2136, strings.TrimSuffix(p.zone, "."), p.server)
+}
+
+func (p *rfc2136Provider) Upsert(rec DNSRecord) error {
+	name, err := p.fqdnInZone(rec.Name)
+	if err != nil {
+		return err
+	}
+	header := dns.RR_Header{Name: name, Class: dns.ClassINET, Ttl: uint32(rec.TTL)}
+	var rr dns.RR
+	switch rec.Type {
+	case "A":
+		header.Rrtype = dns.TypeA
+		rr = &dns.A{Hdr: header, A: net.ParseIP(rec.Value)}
+	case "AAAA":
+		header.Rrtype = dns.TypeAAAA
+		rr = &dns.AAAA{Hdr: header, AAAA: net.ParseIP(rec.Value)}
+	case "CNAME":
+		header.Rrtype = dns.TypeCNAME
+		rr = &dns.CNAME{Hdr: header, Target: dns.Fqdn(rec.Value)}
+	default:
+		return fmt.Errorf("不支持的记录类型 %s", rec.Type)
+	}
+
+	// 1. 归属标记存在且属于本实例：替换记录 (前提条件与更新在同一个请求中，服务器原子执行)
+	m := new(dns.Msg)
+	m.SetUpdate(p.zone)
+	m.Used([]dns.RR{p.ownerMarker(name)})
+	m.RemoveRRset(p.addressRRsets(name))
+	m.Insert([]dns.RR{rr})
+	err = p.send(m)
+	if !errors.Is(err, errPrerequisite) {
+		return err
+	}
+
+	// 2. 同名的 A / AAAA / CNAME 与归属标记都不存在：新建记录并写入标记
+	m = new(dns.Msg)
+	m.SetUpdate(p.zone)
+	m.RRsetNotUsed(append(p.addressRRsets(name), p.markerRRset(name)))
+	m.Insert([]dns.RR{rr, p.ownerMarker(name)})
+	err = p.send(m)
+	if !errors.Is(err, errPrerequisite) {
+		return err
+	}
+
+	// 3. 记录已存在但不是由本实例创建 (手工记录或其它实例)：rec.Adopt 时接管，否则拒绝覆盖
+	if !rec.Adopt {
+		return errDNSNotOwned
+	}
+	m = new(dns.Msg)
+	m.SetUpdate(p.zone)
+	m.RemoveRRset(append(p.addressRRsets(name), p.markerRRset(name)))
+	m.Insert([]dns.RR{rr, p.ownerMarker(name)})
+	return p.send(m)
+}
+
+func (p *rfc2136Provider) Delete(host string) error {
+	name, err := p.fqdnInZone(host)
+	if err != nil {
+		return nil // 区域外的域名不可能由我们创建过记录
+	}
+
+	// 只删除带有本实例归属标记的记录，连同标记一起删除
+	m := new(dns.Msg)
+	m.SetUpdate(p.zone)
+	m.Used([]dns.RR{p.ownerMarker(name)})
+	m.RemoveRRset(append(p.addressRRsets(name), p.markerRRset(name)))
+	err = p.send(m)
+	if !errors.Is(err, errPrerequisite) {
+		return err
+	}
+
+	// 没有归属标记：记录本身也不存在时视为成功，否则不是我们创建的，拒绝删除
+	m = new(dns.Msg)
+	m.SetUpdate(p.zone)
+	m.RRsetNotUsed(p.addressRRsets(name))
+	err = p.send(m)
+	if errors.Is(err, errPrerequisite) {
+		return errDNSNotOwned
+	}
+	return err
+}
+
+// ownerMarker 归属标记：与记录同名但带固定前缀的 TXT 记录 (TXT 不能与 CNAME 同名，名称见 dnsOwnerName)
+// miekg/dns 构造前提条件时会改写 RR 的 TTL，每次使用都重新生成
+func (p *rfc2136Provider) ownerMarker(name string) dns.RR {
+	hdr := dns.RR_Header{Name: dnsOwnerName(name), Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 300}
+	return &dns.TXT{Hdr: hdr, Txt: []string{p.owner}}
+}
+
+func (p *rfc2136Provider) markerRRset(name string) dns.RR {
+	return &dns.ANY{Hdr: dns.RR_Header{Name: dnsOwnerName(name), Rrtype: dns.TypeTXT, Class: dns.ClassINET}}
+}
+
+// addressRRsets 本工具负责的记录类型：同名只能存在 A/AAAA 或 CNAME 其中一种，更新时全部替换
+func (p *rfc2136Provider) addressRRsets(name string) []dns.RR {
+	var rrs []dns.RR
+	for _, t := range []uint16{dns.TypeA, dns.TypeAAAA, dns.TypeCNAME} {
+		rrs = append(rrs, &dns.ANY{Hdr: dns.RR_Header{Name: name, Rrtype: t, Class: dns.ClassINET}})
+	}
+	return rrs
+}
+
+func (p *rfc2136Provider) fqdnInZone(host string) (string, error) {
+	name := dns.Fqdn(host)
+	if !dns.IsSubDomain(p.zone, name) {
+		return "", fmt.Errorf("域名 %s 不在可更新的区域 %s 内", host, strings.TrimSuffix(p.zone, "."))
+	}
+	return name, nil
+}
+
+func (p *rfc2136Provider) exchange(m *dns.Msg) error {
+	c := &dns.Client{Net: "tcp", Timeout: p.timeout}
+	if p.keyName != "" {
+		m.SetTsig(p.keyName, p.algorithm, 300, time.Now().Unix())
+		c.TsigSecret = map[string]string{p.keyName: p.secret}
+	}
+	resp, _, err := c.Exchange(m, p.server)
+	if err != nil {
+		return err
+	}
+	switch resp.Rcode {
+	case dns.RcodeSuccess:
+		return nil
+	case dns.RcodeNXRrset, dns.RcodeYXRrset:
+		return errPrerequisite
+	}
+	return fmt.Errorf("DNS 服务器拒绝更新: %s", dns.RcodeToString[resp.Rcode])
+}
+
+// errPrerequisite 动态更新的前提条件不成立 (NXRRSET / YXRRSET)
+var errPrerequisite = errors.New("前提条件不成立")
@@ -0,0 +1,180 @@
+package internal
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// newTestRFC2136Provider 不连接服务器，把每个更新请求记录下来，按顺序返回 results 中的结果
+func newTestRFC2136Provider(t *testing.T, results ...error) (*rfc2136Provider, *[]*dns.Msg) {
+	t.Helper()
+	p, err := newRFC2136Provider(Config{RFC2136Server: "127.0.0.1", RFC2136Zone: "example.com", DNSOwnerID: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sent []*dns.Msg
+	p.send = func(m *dns.Msg) error {
+		if _, err := m.Pack(); err != nil {
+			t.Fatalf("更新请求无法编码: %v", err)
+		}
+		sent = append(sent, m)
+		if len(sent) > len(results) {
+			t.Fatalf("发送了第 %d 个更新请求，超出预期", len(sent))
+		}
+		return results[len(sent)-1]
+	}
+	return p, &sent
+}
+
+// rrSummary 以 "名称 类别 类型" 描述一组 RR，便于比对前提条件与更新段
+func rrSummary(rrs []dns.RR) []string {
+	var out []string
+	for _, rr := range rrs {
+		h := rr.Header()
+		out = append(out, h.Name+" "+dns.ClassToString[h.Class]+" "+dns.TypeToString[h.Rrtype])
+	}
+	return out
+}
+
+func TestRFC2136UpsertMessages(t *testing.T) {
+	const marker = "_kube-bt-sync.www.example.com."
+	addressRemovals := []string{"www.example.com. ANY A", "www.example.com. ANY AAAA", "www.example.com. ANY CNAME"}
+	rec := DNSRecord{Name: "www.example.com", Type: "A", Value: "203.0.113.10", TTL: 600}
+
+	t.Run("已有本实例标记时原子替换", func(t *testing.T) {
+		p, sent := newTestRFC2136Provider(t, nil)
+		if err := p.Upsert(rec); err != nil {
+			t.Fatal(err)
+		}
+		if len(*sent) != 1 {
+			t.Fatalf("发送了 %d 个请求", len(*sent))
+		}
+		m := (*sent)[0]
+		if m.Opcode != dns.OpcodeUpdate || m.Question[0].Name != "example.com." {
+			t.Fatalf("不是针对区域 example.com 的 UPDATE: %v", m.Question)
+		}
+		if got := rrSummary(m.Answer); !reflect.DeepEqual(got, []string{marker + " IN TXT"}) {
+			t.Errorf("前提条件 = %v", got)
+		}
+		if txt := m.Answer[0].(*dns.TXT); txt.Txt[0] != "heritage=kube-bt-sync,owner=test" || txt.Hdr.Ttl != 0 {
+			t.Errorf("归属标记前提条件 = %v", txt)
+		}
+		if got, want := rrSummary(m.Ns), append(addressRemovals, "www.example.com. IN A"); !reflect.DeepEqual(got, want) {
+			t.Errorf("更新段 = %v, want %v", got, want)
+		}
+		if a := m.Ns[3].(*dns.A); a.A.String() != "203.0.113.10" || a.Hdr.Ttl != 600 {
+			t.Errorf("写入的记录 = %v", a)
+		}
+	})
+
+	t.Run("记录不存在时新建并写入标记", func(t *testing.T) {
+		p, sent := newTestRFC2136Provider(t, errPrerequisite, nil)
+		if err := p.Upsert(rec); err != nil {
+			t.Fatal(err)
+		}
+		m := (*sent)[1]
+		wantPrereq := []string{"www.example.com. NONE A", "www.example.com. NONE AAAA", "www.example.com. NONE CNAME", marker + " NONE TXT"}
+		if got := rrSummary(m.Answer); !reflect.DeepEqual(got, wantPrereq) {
+			t.Errorf("前提条件 = %v", got)
+		}
+		if got := rrSummary(m.Ns); !reflect.DeepEqual(got, []string{"www.example.com. IN A", marker + " IN TXT"}) {
+			t.Errorf("更新段 = %v", got)
+		}
+		if ttl := m.Ns[1].Header().Ttl; ttl == 0 {
+			t.Errorf("写入的归属标记 TTL 为 0")
+		}
+	})
+
+	t.Run("他人创建的记录不接管时拒绝覆盖", func(t *testing.T) {
+		p, sent := newTestRFC2136Provider(t, errPrerequisite, errPrerequisite)
+		if err := p.Upsert(rec); !errors.Is(err, errDNSNotOwned) {
+			t.Fatalf("err = %v, want errDNSNotOwned", err)
+		}
+		if len(*sent) != 2 {
+			t.Fatalf("发送了 %d 个请求，期望 2 个", len(*sent))
+		}
+	})
+
+	t.Run("Adopt 时接管他人创建的记录", func(t *testing.T) {
+		p, sent := newTestRFC2136Provider(t, errPrerequisite, errPrerequisite, nil)
+		adopt := rec
+		adopt.Adopt = true
+		if err := p.Upsert(adopt); err != nil {
+			t.Fatal(err)
+		}
+		m := (*sent)[2]
+		if len(m.Answer) != 0 {
+			t.Errorf("接管请求不应带前提条件: %v", rrSummary(m.Answer))
+		}
+		want := append(append(addressRemovals, marker+" ANY TXT"), "www.example.com. IN A", marker+" IN TXT")
+		if got := rrSummary(m.Ns); !reflect.DeepEqual(got, want) {
+			t.Errorf("更新段 = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("区域外的域名", func(t *testing.T) {
+		p, sent := newTestRFC2136Provider(t)
+		if err := p.Upsert(DNSRecord{Name: "www.example.org", Type: "A", Value: "203.0.113.10"}); err == nil {
+			t.Fatal("区域外的域名应返回错误")
+		}
+		if len(*sent) != 0 {
+			t.Fatalf("不应发送请求")
+		}
+	})
+}
+
+func TestRFC2136WildcardOwnerMarker(t *testing.T) {
+	p, sent := newTestRFC2136Provider(t, nil)
+	if err := p.Upsert(DNSRecord{Name: "*.apps.example.com", Type: "CNAME", Value: "edge.example.com", TTL: 300}); err != nil {
+		t.Fatal(err)
+	}
+	if got := (*sent)[0].Answer[0].Header().Name; got != "_kube-bt-sync._wildcard.apps.example.com." {
+		t.Errorf("通配符域名的归属标记 = %q", got)
+	}
+	if got := (*sent)[0].Ns[3].Header().Name; got != "*.apps.example.com." {
+		t.Errorf("通配符记录名 = %q", got)
+	}
+}
+
+func TestRFC2136DeleteOwnerGuard(t *testing.T) {
+	t.Run("只删除带本实例标记的记录", func(t *testing.T) {
+		p, sent := newTestRFC2136Provider(t, nil)
+		if err := p.Delete("www.example.com"); err != nil {
+			t.Fatal(err)
+		}
+		m := (*sent)[0]
+		if got := rrSummary(m.Answer); !reflect.DeepEqual(got, []string{"_kube-bt-sync.www.example.com. IN TXT"}) {
+			t.Errorf("前提条件 = %v", got)
+		}
+		if len(m.Ns) != 4 {
+			t.Errorf("更新段 = %v", rrSummary(m.Ns))
+		}
+	})
+
+	t.Run("记录已不存在视为成功", func(t *testing.T) {
+		p, _ := newTestRFC2136Provider(t, errPrerequisite, nil)
+		if err := p.Delete("www.example.com"); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("他人创建的记录拒绝删除", func(t *testing.T) {
+		p, sent := newTestRFC2136Provider(t, errPrerequisite, errPrerequisite)
+		if err := p.Delete("www.example.com"); !errors.Is(err, errDNSNotOwned) {
+			t.Fatalf("err = %v, want errDNSNotOwned", err)
+		}
+		if len((*sent)[1].Ns) != 0 {
+			t.Errorf("确认记录是否存在的请求不应带更新段")
+		}
+	})
+
+	t.Run("区域外的域名直接跳过", func(t *testing.T) {
+		p, sent := newTestRFC2136Provider(t)
+		if err := p.Delete("www.example.org"); err != nil || len(*sent) != 0 {
+			t.Fatalf("err = %v, sent = %d", err, len(*sent))
+		}
+	})
+}
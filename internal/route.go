@@ -0,0 +1,241 @@
+package internal
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// 同步引擎内部把 Ingress、HTTPRoute 与 EdgeRoute 统一按 Ingress 的形式处理 (下称"路由")，
+// 只有真正写回 K8s 时才按 Kind 分派到对应的 API
+
+// routeKind 路由的类型，typed client 返回的 Ingress 不带 TypeMeta
+func routeKind(ing networkingv1.Ingress) string {
+	switch ing.Kind {
+	case KindHTTPRoute, KindEdgeRoute:
+		return ing.Kind
+	}
+	return KindIngress
+}
+
+// normalizeKind 旧版本的同步记录没有 Kind 字段，视为 Ingress
+func normalizeKind(kind string) string {
+	if kind == "" {
+		return KindIngress
+	}
+	return kind
+}
+
+// dynamicRoute 通过 dynamic client 访问的路由类型对应的客户端与转换函数，Ingress 返回 nil
+func dynamicRoute(kind, namespace string) (dynamic.ResourceInterface, func(*unstructured.Unstructured) (networkingv1.Ingress, error)) {
+	switch normalizeKind(kind) {
+	case KindHTTPRoute:
+		return httpRoutes(namespace), httpRouteToIngress
+	case KindEdgeRoute:
+		return edgeRoutes(namespace), edgeRouteToIngress
+	}
+	return nil, nil
+}
+
+// dynamicRouteVersion 集群中实际提供的路由版本，对应的 API 未安装时 ok=false
+func dynamicRouteVersion(kind string) (gv schema.GroupVersion, ok bool) {
+	switch normalizeKind(kind) {
+	case KindHTTPRoute:
+		return httpRouteResource.GroupVersion(), gatewayAPIEnabled()
+	case KindEdgeRoute:
+		return edgeRouteResource.GroupVersion(), edgeRoutesEnabled()
+	}
+	return gv, false
+}
+
+// listRoutes 列出管理范围内的全部 Ingress、HTTPRoute 与 EdgeRoute
+func listRoutes(clientset *kubernetes.Clientset, cfg Config) ([]networkingv1.Ingress, error) {
+	items, err := listIngresses(clientset, cfg)
+	if err != nil {
+		return nil, err
+	}
+	routes, err := listHTTPRoutes(cfg)
+	if err != nil {
+		return nil, err
+	}
+	edges, err := listEdgeRoutes(clientset, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return append(append(items, routes...), edges...), nil
+}
+
+// 路由快照：同一轮全量对账、同一批事件触发的队列条目共用一次 List，避免每个域名都全量 List 一次集群
+// 监听器收到任何路由事件、以及每轮全量对账开始时快照都会失效 (generation 递增)，
+// 事件对应的域名被处理时一定会重新 List，看到的不会早于该事件
+var routeSnapshot struct {
+	sync.Mutex
+	generation uint64 // 失效次数
+	listedAt   uint64 // routes 对应的 generation
+	valid      bool
+	routes     []networkingv1.Ingress
+}
+
+// 快照失效后只让一个消费者去 List，其余消费者等待并复用结果
+var routeSnapshotListMutex sync.Mutex
+
+// invalidateRouteSnapshot 路由发生变化 (或可能漏掉了变化) 时调用
+func invalidateRouteSnapshot() {
+	routeSnapshot.Lock()
+	routeSnapshot.generation++
+	routeSnapshot.Unlock()
+}
+
+func currentRouteSnapshot() ([]networkingv1.Ingress, uint64, bool) {
+	routeSnapshot.Lock()
+	defer routeSnapshot.Unlock()
+	return routeSnapshot.routes, routeSnapshot.generation, routeSnapshot.valid && routeSnapshot.listedAt == routeSnapshot.generation
+}
+
+// snapshotRoutes 同步引擎使用的路由列表：快照有效时直接复用，失效后重新 List (结果只读，调用方不能修改)
+func snapshotRoutes(clientset *kubernetes.Clientset, cfg Config) ([]networkingv1.Ingress, error) {
+	if routes, _, ok := currentRouteSnapshot(); ok {
+		return routes, nil
+	}
+	routeSnapshotListMutex.Lock()
+	defer routeSnapshotListMutex.Unlock()
+	routes, generation, ok := currentRouteSnapshot()
+	if ok {
+		return routes, nil
+	}
+	// 先记下 generation 再 List：List 期间到达的事件会让这份结果在保存时就已失效
+	routes, err := listRoutes(clientset, cfg)
+	if err != nil {
+		return nil, err
+	}
+	routeSnapshot.Lock()
+	routeSnapshot.routes, routeSnapshot.listedAt, routeSnapshot.valid = routes, generation, true
+	routeSnapshot.Unlock()
+	return routes, nil
+}
+
+// routeLeftScope 路由仍然存在、但已不在本实例的管理范围内 (标签被改走，或命名空间不再受管)
+// 带标签选择器的 Watch 在标签被改走时同样会发出 DELETED 事件，List 中也不再包含该路由，不能据此执行删除策略
+func routeLeftScope(clientset *kubernetes.Clientset, cfg Config, kind, namespace, name string) (bool, error) {
+	if !namespaceInScope(cfg, namespace) {
+		return true, nil
+	}
+	if _, ok := dynamicRouteVersion(kind); !ok && normalizeKind(kind) != KindIngress {
+		return false, nil
+	}
+	ing, _, err := getRoute(clientset, kind, namespace, name)
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return ing.DeletionTimestamp == nil && !ingressInScope(cfg, ing), nil
+}
+
+// releaseRoute 路由移出管理范围后 (可能已由其它实例接管)，只删除本实例的同步记录并摘掉 finalizer，宝塔端保持不变
+func releaseRoute(clientset *kubernetes.Clientset, cfg Config, kind, namespace, name string) error {
+	// 不再受管的命名空间可能已经没有写权限，也不会再收到它的删除事件，只清理本地记录
+	if namespaceInScope(cfg, namespace) {
+		if err := removeCleanupFinalizer(clientset, kind, namespace, name); err != nil {
+			return err
+		}
+	}
+	owner := namespace + "/" + name
+	for _, host := range hostsOwnedBy(kind, namespace, name) {
+		cacheMutex.Lock()
+		delete(syncedCache, host)
+		cacheMutex.Unlock()
+		slog.Info("路由已移出管理范围，解除管理，宝塔端保持不变", "host", host, "kind", kind, "namespace", namespace, "ingress", name, "action", "release")
+		recordHistoryNote(host, owner, "release", "路由已移出本实例的管理范围，宝塔端保持不变")
+	}
+	return nil
+}
+
+// getRoute 读取路由，同时返回可用于记录 Event 的原始对象
+func getRoute(clientset *kubernetes.Clientset, kind, namespace, name string) (*networkingv1.Ingress, runtime.Object, error) {
+	if client, convert := dynamicRoute(kind, namespace); client != nil {
+		u, err := client.Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			return nil, nil, err
+		}
+		ing, err := convert(u)
+		return &ing, u, err
+	}
+	ing, err := clientset.NetworkingV1().Ingresses(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	return ing, ing, err
+}
+
+// patchRoute 对路由执行 merge patch，返回更新后的 Ingress 形式与原始对象
+func patchRoute(clientset *kubernetes.Clientset, kind, namespace, name string, patch []byte) (*networkingv1.Ingress, runtime.Object, error) {
+	if client, convert := dynamicRoute(kind, namespace); client != nil {
+		u, err := client.Patch(context.TODO(), name, types.MergePatchType, patch, metav1.PatchOptions{})
+		if err != nil {
+			return nil, nil, err
+		}
+		ing, err := convert(u)
+		return &ing, u, err
+	}
+	ing, err := clientset.NetworkingV1().Ingresses(namespace).Patch(context.TODO(), name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return ing, ing, err
+}
+
+// updateRouteFinalizers 读取路由并按 mutate 的结果改写 finalizers (changed=false 时不写)，冲突时自动重试；路由不存在视为成功
+func updateRouteFinalizers(clientset *kubernetes.Clientset, kind, namespace, name string, mutate func(ing networkingv1.Ingress) (finalizers []string, changed bool)) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if client, convert := dynamicRoute(kind, namespace); client != nil {
+			u, err := client.Get(context.TODO(), name, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			ing, err := convert(u)
+			if err != nil {
+				return err
+			}
+			finalizers, changed := mutate(ing)
+			if !changed {
+				return nil
+			}
+			u.SetFinalizers(finalizers)
+			_, err = client.Update(context.TODO(), u, metav1.UpdateOptions{})
+			return err
+		}
+
+		ing, err := clientset.NetworkingV1().Ingresses(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		finalizers, changed := mutate(*ing)
+		if !changed {
+			return nil
+		}
+		ing.Finalizers = finalizers
+		_, err = clientset.NetworkingV1().Ingresses(namespace).Update(context.TODO(), ing, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// deleteRoute 删除路由
+func deleteRoute(clientset *kubernetes.Clientset, kind, namespace, name string) error {
+	if client, _ := dynamicRoute(kind, namespace); client != nil {
+		return client.Delete(context.TODO(), name, metav1.DeleteOptions{})
+	}
+	return clientset.NetworkingV1().Ingresses(namespace).Delete(context.TODO(), name, metav1.DeleteOptions{})
+}
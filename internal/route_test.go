@@ -0,0 +1,79 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRouteLeftScope(t *testing.T) {
+	// app/blue 标签匹配，app/red 标签已被改走，app/gone 已被删除
+	clientset := newTestClientset(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/apis/networking.k8s.io/v1/namespaces/app/ingresses/blue":
+			fmt.Fprint(w, `{"kind":"Ingress","apiVersion":"networking.k8s.io/v1","metadata":{"name":"blue","namespace":"app","labels":{"team":"blue"}}}`)
+		case "/apis/networking.k8s.io/v1/namespaces/app/ingresses/red":
+			fmt.Fprint(w, `{"kind":"Ingress","apiVersion":"networking.k8s.io/v1","metadata":{"name":"red","namespace":"app","labels":{"team":"red"}}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"NotFound","code":404}`)
+		}
+	}))
+	cfg := Config{WatchNamespaces: []string{"app"}, LabelSelector: "team=blue"}
+
+	cases := []struct {
+		namespace, name string
+		want            bool
+	}{
+		{"app", "blue", false},
+		{"app", "red", true},
+		{"app", "gone", false},
+		{"other", "web", true},
+	}
+	for _, c := range cases {
+		got, err := routeLeftScope(clientset, cfg, KindIngress, c.namespace, c.name)
+		if err != nil {
+			t.Fatalf("%s/%s: %v", c.namespace, c.name, err)
+		}
+		if got != c.want {
+			t.Errorf("routeLeftScope(%s/%s) = %v, want %v", c.namespace, c.name, got, c.want)
+		}
+	}
+}
+
+func TestSnapshotRoutesListsOncePerGeneration(t *testing.T) {
+	var lists atomic.Int32
+	clientset := newTestClientset(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/apis/networking.k8s.io/v1/ingresses" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		lists.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"kind":"IngressList","apiVersion":"networking.k8s.io/v1","items":[{"metadata":{"name":"web","namespace":"app"}}]}`)
+	}))
+	invalidateRouteSnapshot()
+
+	for i := 0; i < 3; i++ {
+		routes, err := snapshotRoutes(clientset, Config{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(routes) != 1 || routes[0].Name != "web" {
+			t.Fatalf("routes = %+v", routes)
+		}
+	}
+	if got := lists.Load(); got != 1 {
+		t.Fatalf("同一快照内 List 了 %d 次，期望 1 次", got)
+	}
+
+	invalidateRouteSnapshot()
+	if _, err := snapshotRoutes(clientset, Config{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := lists.Load(); got != 2 {
+		t.Fatalf("快照失效后 List 次数 = %d，期望 2", got)
+	}
+}
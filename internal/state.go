@@ -0,0 +1,140 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// 同步记录在 ConfigMap 中的 key (域名可能含 "*"，不能直接作为 ConfigMap 的 key，统一序列化为一个 JSON)
+const stateDataKey = "records.json"
+
+var stateMutex sync.Mutex
+var lastSavedState string
+
+// 同步记录的写入合并：消费者处理完一个域名后只标记待写入，由后台协程按固定间隔统一写回 ConfigMap
+// (进程异常退出时最多丢失一个间隔内的变更，重启后按集群现状重新对账即可补齐)
+var syncStateSaveInterval = 2 * time.Second
+var syncStateDirty atomic.Bool
+
+// requestSyncStateSave 标记同步记录有待写入
+func requestSyncStateSave() {
+	syncStateDirty.Store(true)
+}
+
+// runSyncStateSaver 后台写入协程，随同步队列消费者一起启动
+func runSyncStateSaver(clientset *kubernetes.Clientset, cfg Config) {
+	for range time.Tick(syncStateSaveInterval) {
+		flushSyncState(clientset, cfg)
+	}
+}
+
+// flushSyncState 有待写入的变更时写回一次 (失败时保留标记，下个间隔重试)
+func flushSyncState(clientset *kubernetes.Clientset, cfg Config) {
+	if !syncStateDirty.Swap(false) {
+		return
+	}
+	if err := saveSyncState(clientset, cfg); err != nil {
+		syncStateDirty.Store(true)
+	}
+}
+
+// LoadSyncState 启动时从 ConfigMap 恢复同步记录，避免重启后对所有域名重新执行 AddSite/CreateProxy
+func LoadSyncState(clientset *kubernetes.Clientset, cfg Config) {
+	records, raw, err := readSyncState(clientset, cfg)
+	if apierrors.IsNotFound(err) {
+		slog.Info("未找到状态 ConfigMap，以空记录启动", "namespace", cfg.PodNamespace, "configmap", cfg.StateConfigMap)
+		return
+	}
+	if err != nil {
+		slog.Warn("读取状态 ConfigMap 失败，以空记录启动", "namespace", cfg.PodNamespace, "configmap", cfg.StateConfigMap, "error", err)
+		return
+	}
+
+	replaceSyncRecords(records)
+	stateMutex.Lock()
+	lastSavedState = raw
+	stateMutex.Unlock()
+	slog.Info("已从 ConfigMap 恢复同步记录", "count", len(records))
+}
+
+// refreshSyncState 非 Leader 副本不运行同步引擎，展示数据前从 ConfigMap 刷新一次记录
+func refreshSyncState(clientset *kubernetes.Clientset, cfg Config) {
+	if records, _, err := readSyncState(clientset, cfg); err == nil {
+		replaceSyncRecords(records)
+	}
+}
+
+func readSyncState(clientset *kubernetes.Clientset, cfg Config) (map[string]SyncRecord, string, error) {
+	cm, err := clientset.CoreV1().ConfigMaps(cfg.PodNamespace).Get(context.TODO(), cfg.StateConfigMap, metav1.GetOptions{})
+	if err != nil {
+		return nil, "", err
+	}
+	records := make(map[string]SyncRecord)
+	if err := json.Unmarshal([]byte(cm.Data[stateDataKey]), &records); err != nil {
+		return nil, "", fmt.Errorf("状态 ConfigMap 内容损坏: %w", err)
+	}
+	return records, cm.Data[stateDataKey], nil
+}
+
+func replaceSyncRecords(records map[string]SyncRecord) {
+	cacheMutex.Lock()
+	syncedCache = records
+	cacheMutex.Unlock()
+}
+
+// saveSyncState 把当前同步记录写回 ConfigMap，内容未变化时跳过写入
+func saveSyncState(clientset *kubernetes.Clientset, cfg Config) error {
+	// dry-run 模式不修改任何持久化状态
+	if cfg.DryRun {
+		return nil
+	}
+	cacheMutex.RLock()
+	data, err := json.Marshal(syncedCache)
+	cacheMutex.RUnlock()
+	if err != nil {
+		slog.Warn("序列化同步记录失败", "error", err)
+		return err
+	}
+
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+	if string(data) == lastSavedState {
+		return nil
+	}
+
+	client := clientset.CoreV1().ConfigMaps(cfg.PodNamespace)
+	cm, err := client.Get(context.TODO(), cfg.StateConfigMap, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      cfg.StateConfigMap,
+				Namespace: cfg.PodNamespace,
+				Labels:    map[string]string{"app.kubernetes.io/managed-by": "kube-bt-sync"},
+			},
+			Data: map[string]string{stateDataKey: string(data)},
+		}
+		_, err = client.Create(context.TODO(), cm, metav1.CreateOptions{})
+	} else if err == nil {
+		if cm.Data == nil {
+			cm.Data = make(map[string]string)
+		}
+		cm.Data[stateDataKey] = string(data)
+		_, err = client.Update(context.TODO(), cm, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		slog.Warn("写入状态 ConfigMap 失败，稍后重试", "namespace", cfg.PodNamespace, "configmap", cfg.StateConfigMap, "error", err)
+		return err
+	}
+	lastSavedState = string(data)
+	return nil
+}
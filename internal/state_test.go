@@ -0,0 +1,48 @@
+package internal
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+func TestFlushSyncStateCoalescesWrites(t *testing.T) {
+	store := newFakeConfigMaps()
+	var writes atomic.Int32
+	clientset := newTestClientset(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writes.Add(1)
+		}
+		store.ServeHTTP(w, r)
+	}))
+	cfg := Config{PodNamespace: "kube-bt-sync", StateConfigMap: "kube-bt-sync-state"}
+	setSyncedCache(t, map[string]SyncRecord{})
+	stateMutex.Lock()
+	lastSavedState = ""
+	stateMutex.Unlock()
+	syncStateDirty.Store(false)
+
+	// 多个域名处理完成只标记待写入，不直接写 ConfigMap
+	for _, host := range []string{"a.example.com", "b.example.com", "c.example.com"} {
+		cacheMutex.Lock()
+		syncedCache[host] = SyncRecord{Namespace: "app", Ingress: "web"}
+		cacheMutex.Unlock()
+		requestSyncStateSave()
+	}
+	if got := writes.Load(); got != 0 {
+		t.Fatalf("标记阶段写入了 %d 次", got)
+	}
+
+	flushSyncState(clientset, cfg)
+	flushSyncState(clientset, cfg)
+	if got := writes.Load(); got != 1 {
+		t.Fatalf("写入次数 = %d，期望合并为 1 次", got)
+	}
+	records, _, err := readSyncState(clientset, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("写回的记录数 = %d，期望 3", len(records))
+	}
+}
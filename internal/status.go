@@ -0,0 +1,141 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// 写回 Ingress 的状态注解：sync-phase 为汇总结果，sync-status 为按域名展开的 JSON 明细 (EdgeRoute 写入 status 子资源)
+const (
+	syncPhaseAnnotation  = "kube-bt-sync.io/sync-phase"
+	syncStatusAnnotation = "kube-bt-sync.io/sync-status"
+)
+
+const (
+	SyncPhaseSynced = "Synced"
+	SyncPhaseFailed = "Failed"
+)
+
+// HostSyncStatus 单个域名的同步结果
+type HostSyncStatus struct {
+	Phase        string `json:"phase"`
+	Target       string `json:"target"`
+	LastSyncTime string `json:"lastSyncTime,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+var eventRecorder record.EventRecorder
+
+// StartEventRecorder 初始化 K8s Event 记录器，之后同步结果会以 Event 形式挂在 Ingress 上 (kubectl describe 可见)
+func StartEventRecorder(clientset *kubernetes.Clientset) {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+	eventRecorder = broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "kube-bt-sync"})
+}
+
+// readHostStatuses 解析 Ingress 上的按域名同步明细
+func readHostStatuses(ing networkingv1.Ingress) map[string]HostSyncStatus {
+	statuses := make(map[string]HostSyncStatus)
+	if raw, ok := ing.Annotations[syncStatusAnnotation]; ok && raw != "" {
+		json.Unmarshal([]byte(raw), &statuses)
+	}
+	return statuses
+}
+
+// recordSyncResult 一次真正的宝塔下发结束后，写回状态注解并发出 Synced / SyncFailed 事件
+func recordSyncResult(clientset *kubernetes.Clientset, target ProxyTarget, syncErr error) {
+	status := HostSyncStatus{Phase: SyncPhaseSynced, Target: target.TargetURL, LastSyncTime: time.Now().Format(time.RFC3339)}
+	if syncErr != nil {
+		status.Phase = SyncPhaseFailed
+		status.Error = syncErr.Error()
+	}
+
+	obj, err := patchHostStatus(clientset, target, status)
+	if err != nil {
+		slog.Warn("写回同步状态失败", "host", target.Domain, "kind", normalizeKind(target.Kind), "namespace", target.Namespace, "ingress", target.Ingress, "error", err)
+		return
+	}
+	if eventRecorder == nil {
+		return
+	}
+	if syncErr != nil {
+		eventRecorder.Eventf(obj, corev1.EventTypeWarning, "SyncFailed", "同步 %s 到宝塔失败: %v", target.Domain, syncErr)
+	} else {
+		eventRecorder.Eventf(obj, corev1.EventTypeNormal, "Synced", "已同步 %s 到宝塔，反代目标 %s", target.Domain, target.TargetURL)
+	}
+}
+
+// reportConfigError 注解无效时写回失败状态；相同的错误已经写回过则跳过，避免状态注解变更反复触发对账
+func reportConfigError(clientset *kubernetes.Clientset, ingresses []networkingv1.Ingress, target ProxyTarget) {
+	for _, ing := range ingresses {
+		if routeKind(ing) != normalizeKind(target.Kind) || ing.Namespace != target.Namespace || ing.Name != target.Ingress {
+			continue
+		}
+		if st, ok := readHostStatuses(ing)[target.Domain]; ok && st.Phase == SyncPhaseFailed && st.Error == target.ConfigError {
+			return
+		}
+	}
+	slog.Warn("注解无效，跳过同步", "host", target.Domain, "kind", normalizeKind(target.Kind), "namespace", target.Namespace, "ingress", target.Ingress, "action", "invalid-config", "error", target.ConfigError)
+	recordHistory(target.Domain, target.Namespace+"/"+target.Ingress, "invalid-config", errors.New(target.ConfigError))
+	recordSyncResult(clientset, target, errors.New(target.ConfigError))
+}
+
+// ensureSyncedStatus 宝塔端无需变更时，仅在注解缺失或过期时补写 (例如升级后首次运行)，不重复发事件
+func ensureSyncedStatus(clientset *kubernetes.Clientset, target ProxyTarget, record SyncRecord) {
+	status := HostSyncStatus{Phase: SyncPhaseSynced, Target: target.TargetURL, LastSyncTime: record.SyncedAt.Format(time.RFC3339)}
+	if _, err := patchHostStatus(clientset, target, status); err != nil {
+		slog.Warn("写回同步状态失败", "host", target.Domain, "kind", normalizeKind(target.Kind), "namespace", target.Namespace, "ingress", target.Ingress, "error", err)
+	}
+}
+
+// patchHostStatus 合并写入某个域名的状态，并清理路由上已不存在的域名条目；内容无变化时不发起写请求
+// 返回路由的原始对象，用于记录 Event
+func patchHostStatus(clientset *kubernetes.Clientset, target ProxyTarget, status HostSyncStatus) (runtime.Object, error) {
+	ing, obj, err := getRoute(clientset, target.Kind, target.Namespace, target.Ingress)
+	if err != nil {
+		return nil, err
+	}
+	// EdgeRoute 只声明一个域名，结果直接写入 status 子资源
+	if normalizeKind(target.Kind) == KindEdgeRoute {
+		return patchEdgeRouteStatus(obj, status)
+	}
+
+	statuses := readHostStatuses(*ing)
+	if statuses[target.Domain] == status && ing.Annotations[syncPhaseAnnotation] != "" {
+		return obj, nil
+	}
+	statuses[target.Domain] = status
+
+	phase := SyncPhaseSynced
+	for host, st := range statuses {
+		if !declaresHost(*ing, host) {
+			delete(statuses, host)
+			continue
+		}
+		if st.Phase == SyncPhaseFailed {
+			phase = SyncPhaseFailed
+		}
+	}
+
+	raw, _ := json.Marshal(statuses)
+	patch, _ := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{syncPhaseAnnotation: phase, syncStatusAnnotation: string(raw)},
+		},
+	})
+	_, obj, err = patchRoute(clientset, target.Kind, target.Namespace, target.Ingress, patch)
+	if err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
@@ -1,43 +1,221 @@
 package internal
 
 import (
-	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"strings"
 	"sync"
 	"time"
 
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/workqueue"
 )
 
 type ProxyTarget struct {
-	Domain    string
-	TargetURL string
+	Kind           string // 声明该域名的路由类型：Ingress / HTTPRoute / EdgeRoute
+	Namespace      string
+	Ingress        string
+	Domain         string
+	TargetURL      string
+	Upstream       Upstream
+	SSLMode        string
+	Access         AccessRules
+	Resolver       string // NGINX_RESOLVER，变更后需要重写反代配置文件
+	CABundle       string // UPSTREAM_CA_BUNDLE，校验上游证书时变更后需要重写反代配置文件
+	DeletionPolicy string
+	ConfigError    string // 注解 (或 EdgeRoute 字段) 无效时的错误，此时不会调用宝塔，已同步的配置保持不变
 }
 
-var syncedCache = make(map[string]string)
+// 删除策略：Ingress 被删除 (或不再声明该域名) 后，宝塔端如何处理
+const (
+	DeletionPolicyRetain      = "retain"       // 保留站点与反代 (默认，与历史行为一致)
+	DeletionPolicyDeleteProxy = "delete-proxy" // 仅移除反代规则，保留站点
+	DeletionPolicyDeleteSite  = "delete-site"  // 连同站点一起删除
+)
+
+// SyncRecord 已成功下发到宝塔的域名记录，删除时依据其中的归属与策略进行清理
+// 记录会持久化到 ConfigMap，重启后据此跳过已同步的域名
+type SyncRecord struct {
+	Kind           string    `json:"kind,omitempty"` // 为空表示 Ingress (兼容旧版本记录)
+	Namespace      string    `json:"namespace"`
+	Ingress        string    `json:"ingress"`
+	TargetURL      string    `json:"targetURL"`
+	DeletionPolicy string    `json:"deletionPolicy"`
+	ConfigHash     string    `json:"configHash"`
+	SyncedAt       time.Time `json:"syncedAt"`            // 最近一次真正调用宝塔下发的时间
+	UpdatedAt      time.Time `json:"updatedAt"`           // 最近一次记录变更的时间
+	LastError      string    `json:"lastError,omitempty"` // 最近一次下发失败的原因，下发成功后清空
+}
+
+// configHash 宝塔端反代配置的指纹，任何会影响宝塔配置的字段都必须参与计算
+func (t ProxyTarget) configHash() string {
+	parts := []string{t.Domain, t.TargetURL, ProxyName}
+	if t.Upstream.VerifyTLS {
+		parts = append(parts, "verify-tls", "ca="+t.CABundle)
+	}
+	// 以下选项只在非默认值时参与计算，保证升级前已同步的域名指纹不变
+	if t.SSLMode != "" && t.SSLMode != SSLModeNone {
+		parts = append(parts, "ssl="+t.SSLMode)
+	}
+	if len(t.Access.Allow) > 0 {
+		parts = append(parts, "allow="+strings.Join(t.Access.Allow, ","))
+	}
+	if len(t.Access.Deny) > 0 {
+		parts = append(parts, "deny="+strings.Join(t.Access.Deny, ","))
+	}
+	if t.Resolver != "" {
+		parts = append(parts, "resolver="+t.Resolver)
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "|")))
+	return hex.EncodeToString(sum[:])
+}
+
+var syncedCache = make(map[string]SyncRecord)
 // 【新增】专门用于存放实时执行进度的缓存字典
 var progressCache = make(map[string]string) 
 var cacheMutex sync.RWMutex
-var syncExecutionMutex sync.Mutex
+var resyncMutex sync.Mutex
+
+// 【核心升级】以域名为 Key 的限速去重工作队列：
+// 同一域名在队列中只会存在一份，正在处理时再次入队会在处理完后重新执行一次，失败则按指数退避重试
+var syncQueue = workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "kube-bt-sync")
 
 var loopCount int64 = 0
 
+// 深度巡检中连续发现 "宝塔端缺失" 的次数，用于 delete-ingress 策略的多次确认
+var missingCounts = make(map[string]int)
+
+// StartSyncer 周期性全量对账：兜底事件遗漏，并检测宝塔端配置漂移
 func StartSyncer(k8sClient *kubernetes.Clientset, cfg Config) {
-	log.Printf("同步引擎启动 (间隔: %v)...", cfg.SyncInterval)
+	slog.Info("同步引擎启动", "interval", cfg.SyncInterval)
 	for {
-		syncOnce(k8sClient, cfg)
+		// 启动时的首轮对账已由事件监听器建立连接时触发，这里先等待一个周期
 		<-time.After(cfg.SyncInterval)
+		syncOnce(k8sClient, cfg)
 	}
 }
 
+// StartSyncWorker 启动 SYNC_WORKERS 个队列消费者，不同域名并发同步
+// (队列保证同一域名同一时刻只被一个消费者处理，会重载 Nginx 的宝塔调用按面板串行)
+func StartSyncWorker(k8sClient *kubernetes.Clientset, cfg Config) {
+	slog.Info("同步队列消费者已启动", "workers", cfg.SyncWorkers)
+	go runSyncStateSaver(k8sClient, cfg)
+	for i := 1; i < cfg.SyncWorkers; i++ {
+		go runSyncWorker(k8sClient, cfg)
+	}
+	runSyncWorker(k8sClient, cfg)
+}
+
+func runSyncWorker(k8sClient *kubernetes.Clientset, cfg Config) {
+	for processNextHost(k8sClient, cfg) {
+	}
+}
+
+func processNextHost(k8sClient *kubernetes.Clientset, cfg Config) bool {
+	item, shutdown := syncQueue.Get()
+	if shutdown {
+		return false
+	}
+	defer syncQueue.Done(item)
+
+	if ref, ok := item.(routeRef); ok {
+		if err := reconcileFinalizer(k8sClient, cfg, ref); err != nil {
+			slog.Error("清理删除中的路由失败，稍后重试", "kind", ref.Kind, "namespace", ref.Namespace, "ingress", ref.Name, "attempt", syncQueue.NumRequeues(ref)+1, "error", err)
+			syncQueue.AddRateLimited(ref)
+			return true
+		}
+		syncQueue.Forget(ref)
+		return true
+	}
+
+	host := item.(string)
+	start := time.Now()
+	err := reconcileHost(k8sClient, cfg, host)
+	observeSync(host, start, err)
+	if err == nil && !cfg.DryRun && !hostTracked(host) {
+		// 域名已解除管理 (或从未成功下发)，不再保留它的指标
+		forgetHostMetrics(host)
+	}
+	requestSyncStateSave()
+	if err != nil {
+		slog.Error("同步失败，稍后重试", "host", host, "attempt", syncQueue.NumRequeues(host)+1, "duration", time.Since(start), "error", err)
+		syncQueue.AddRateLimited(host)
+		return true
+	}
+	slog.Debug("对账完成", "host", host, "duration", time.Since(start))
+	syncQueue.Forget(host)
+	return true
+}
+
+// TriggerSync 触发一次全量对账 (只负责把域名投递进队列，真正的同步由队列消费者完成)
 func TriggerSync(k8sClient *kubernetes.Clientset, cfg Config) {
 	go syncOnce(k8sClient, cfg)
 }
 
+// EnqueueIngress 将 Ingress 上声明的所有域名，以及此前由它下发、现已移除的域名投递进同步队列
+func EnqueueIngress(ing *networkingv1.Ingress) {
+	for _, rule := range ing.Spec.Rules {
+		if rule.Host != "" {
+			syncQueue.Add(rule.Host)
+		}
+	}
+	for _, host := range hostsOwnedBy(routeKind(*ing), ing.Namespace, ing.Name) {
+		syncQueue.Add(host)
+	}
+	enqueueFinalize(*ing)
+}
+
+// IsManagedIngress 带有同步注解且 IngressClass 匹配，或者此前由本工具下发过域名的 Ingress 都需要关注
+// (后者用于捕捉注解被移除、class 被改走的情况)
+func IsManagedIngress(cfg Config, ing *networkingv1.Ingress) bool {
+	if wantsSync(cfg, *ing) {
+		return true
+	}
+	if hasCleanupFinalizer(*ing) {
+		return true
+	}
+	return len(hostsOwnedBy(routeKind(*ing), ing.Namespace, ing.Name)) > 0
+}
+
+// hostTracked 域名是否仍有同步记录
+func hostTracked(host string) bool {
+	cacheMutex.RLock()
+	defer cacheMutex.RUnlock()
+	_, ok := syncedCache[host]
+	return ok
+}
+
+func hostsOwnedBy(kind, namespace, name string) []string {
+	cacheMutex.RLock()
+	defer cacheMutex.RUnlock()
+
+	var hosts []string
+	for host, record := range syncedCache {
+		if normalizeKind(record.Kind) == kind && record.Namespace == namespace && record.Ingress == name {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// parseDeletionPolicy 读取删除策略注解，未填写或填写错误时回退为 retain，避免误删
+func parseDeletionPolicy(ing networkingv1.Ingress) string {
+	policy, ok := ing.Annotations["kube-bt-sync.io/deletion-policy"]
+	if !ok || policy == "" {
+		return DeletionPolicyRetain
+	}
+	switch policy {
+	case DeletionPolicyRetain, DeletionPolicyDeleteProxy, DeletionPolicyDeleteSite:
+		return policy
+	}
+	slog.Warn("删除策略无效，按 retain 处理", "kind", routeKind(ing), "namespace", ing.Namespace, "ingress", ing.Name, "policy", policy)
+	return DeletionPolicyRetain
+}
+
 // 【升级】状态查询逻辑：优先展示实时进度，如果没有进度再查是否已同步
 func GetSyncStatus(domain string, expectedURL string) string {
 	cacheMutex.RLock()
@@ -49,14 +227,21 @@ func GetSyncStatus(domain string, expectedURL string) string {
 	}
 	
 	// 2. 如果没有进度，说明执行完了，检查结果
-	if cachedURL, ok := syncedCache[domain]; ok {
-		if cachedURL == expectedURL {
+	if record, ok := syncedCache[domain]; ok && record.LastError == "" {
+		if record.TargetURL == expectedURL {
 			return "✅ 已同步"
 		}
 	}
 	return "⏳ 等待处理队列中..."
 }
 
+// IsSyncInProgress 该域名当前是否正在执行宝塔操作
+func IsSyncInProgress(domain string) bool {
+	cacheMutex.RLock()
+	defer cacheMutex.RUnlock()
+	return progressCache[domain] != ""
+}
+
 // 辅助方法：快速更新并暴露进度
 func updateProgress(domain string, msg string) {
 	cacheMutex.Lock()
@@ -68,9 +253,190 @@ func updateProgress(domain string, msg string) {
 	cacheMutex.Unlock()
 }
 
+// collectTargets 汇总所有带同步注解、IngressClass 匹配且未处于删除中的 Ingress，得到 域名 -> 期望反代目标 的映射
+// 同一域名被多个 Ingress 声明时，以 List 结果中第一个为准
+func collectTargets(cfg Config, ingresses []networkingv1.Ingress) map[string]ProxyTarget {
+	targets := make(map[string]ProxyTarget)
+	for _, ing := range ingresses {
+		if !wantsSync(cfg, ing) {
+			continue
+		}
+		if ing.DeletionTimestamp != nil {
+			continue
+		}
+		upstream, sslMode, access, optionsErr := parseProxyOptions(cfg, ing)
+		configError := ""
+		if optionsErr != nil {
+			configError = optionsErr.Error()
+		}
+		policy := parseDeletionPolicy(ing)
+		for _, rule := range ing.Spec.Rules {
+			if rule.Host == "" {
+				continue
+			}
+			if _, dup := targets[rule.Host]; dup {
+				continue
+			}
+			targets[rule.Host] = ProxyTarget{
+				Kind: routeKind(ing), Namespace: ing.Namespace, Ingress: ing.Name, Domain: rule.Host,
+				TargetURL: upstream.URL(), Upstream: upstream, SSLMode: sslMode, Access: access, Resolver: cfg.NginxResolver, CABundle: cfg.UpstreamCABundle, DeletionPolicy: policy, ConfigError: configError,
+			}
+		}
+	}
+	return targets
+}
+
+// reconcileHost 对单个域名执行一次对账：期望状态来自集群中的 Ingress，实际状态来自同步缓存
+func reconcileHost(clientset *kubernetes.Clientset, cfg Config, host string) error {
+	ingresses, err := snapshotRoutes(clientset, cfg)
+	if err != nil {
+		return fmt.Errorf("获取 Ingress 列表失败: %w", err)
+	}
+	targets := collectTargets(cfg, ingresses)
+
+	// dry-run 模式：只输出将要执行的动作 (删除中的 Ingress 保留 finalizer，保持 Terminating)
+	if cfg.DryRun {
+		logDryRunPlan(host, planHost(cfg, host, ingresses, targets))
+		return nil
+	}
+
+	// 先处理持有 finalizer、但已进入删除流程 (或不再需要 finalizer) 的 Ingress
+	released := false
+	for _, ing := range ingresses {
+		if hasCleanupFinalizer(ing) && !needsCleanupFinalizer(cfg, ing) && declaresHost(ing, host) {
+			if err := finalizeIngress(clientset, cfg, ing, targets); err != nil {
+				return err
+			}
+			released = true
+		}
+	}
+
+	target, wanted := targets[host]
+
+	cacheMutex.RLock()
+	record, exists := syncedCache[host]
+	cacheMutex.RUnlock()
+
+	// 域名已不再被任何 Ingress 声明：按下发时记录的删除策略清理宝塔端
+	// (所属路由只是移出了管理范围时不做清理，只解除管理)
+	if !wanted {
+		if !exists || released {
+			return nil
+		}
+		left, err := routeLeftScope(clientset, cfg, normalizeKind(record.Kind), record.Namespace, record.Ingress)
+		if err != nil {
+			return fmt.Errorf("读取路由失败: %w", err)
+		}
+		if left {
+			return releaseRoute(clientset, cfg, normalizeKind(record.Kind), record.Namespace, record.Ingress)
+		}
+		if err := applyDeletionPolicy(cfg, host, record); err != nil {
+			return err
+		}
+		cacheMutex.Lock()
+		delete(syncedCache, host)
+		cacheMutex.Unlock()
+		return nil
+	}
+
+	// 注解无效：不动宝塔端 (已同步的配置保持原样)，只把错误写回 Ingress，等待用户修正
+	if target.ConfigError != "" {
+		reportConfigError(clientset, ingresses, target)
+		return nil
+	}
+
+	hash := target.configHash()
+	if exists && record.ConfigHash == hash {
+		// 宝塔端配置未变，只需刷新归属与删除策略，无需再调用宝塔
+		if normalizeKind(record.Kind) != target.Kind || record.Namespace != target.Namespace || record.Ingress != target.Ingress || record.DeletionPolicy != target.DeletionPolicy {
+			record.Kind, record.Namespace, record.Ingress, record.DeletionPolicy = target.Kind, target.Namespace, target.Ingress, target.DeletionPolicy
+			record.UpdatedAt = time.Now()
+			cacheMutex.Lock()
+			syncedCache[host] = record
+			cacheMutex.Unlock()
+		}
+		ensureSyncedStatus(clientset, target, record)
+		ensureDNSRecord(cfg, host, target.Namespace+"/"+target.Ingress)
+		return ensureCleanupFinalizer(clientset, cfg, target)
+	}
+
+	// 【核心升级】执行带实时进度反馈的底层操作
+	start := time.Now()
+	err = ensureBaotaSiteAndProxy(cfg, target)
+	if err == nil {
+		slog.Info("宝塔端同步完成", "host", host, "kind", target.Kind, "namespace", target.Namespace, "ingress", target.Ingress,
+			"action", "provision", "target", target.TargetURL, "duration", time.Since(start))
+	}
+	recordHistory(host, target.Namespace+"/"+target.Ingress, "provision", err)
+	previous := ""
+	if exists {
+		previous = record.TargetURL
+	}
+	recordAudit(AuditActorController, AuditActionBaotaProvision, host, "来自 "+routeTarget(target.Kind, target.Namespace, target.Ingress), previous, target.TargetURL, err)
+	recordSyncResult(clientset, target, err)
+
+	cacheMutex.Lock()
+	if err == nil {
+		now := time.Now()
+		syncedCache[host] = SyncRecord{
+			Kind: target.Kind, Namespace: target.Namespace, Ingress: target.Ingress, TargetURL: target.TargetURL,
+			DeletionPolicy: target.DeletionPolicy, ConfigHash: hash, SyncedAt: now, UpdatedAt: now,
+		}
+	} else if exists {
+		// 保留上一次成功下发的记录 (归属、删除策略与指纹不变)，域名之后被移除时仍能按策略清理，下一轮会继续重试
+		record.LastError = err.Error()
+		record.UpdatedAt = time.Now()
+		syncedCache[host] = record
+	}
+	cacheMutex.Unlock()
+
+	// 无论成功失败，结束时清空该域名的进度条显示
+	updateProgress(host, "")
+	if err != nil {
+		return err
+	}
+	ensureDNSRecord(cfg, host, target.Namespace+"/"+target.Ingress)
+	probeAfterSync(cfg, target)
+	return ensureCleanupFinalizer(clientset, cfg, target)
+}
+
+// applyDeletionPolicy 按删除策略清理宝塔端，并把结果写入同步历史
+func applyDeletionPolicy(cfg Config, host string, record SyncRecord) error {
+	owner := record.Namespace + "/" + record.Ingress
+	policy := record.DeletionPolicy
+	if policy == "" {
+		policy = DeletionPolicyRetain
+	}
+
+	var err error
+	switch policy {
+	case DeletionPolicyDeleteProxy:
+		updateProgress(host, "⏳ 正在移除宝塔反代规则...")
+		err = DeleteBaotaProxy(cfg, host)
+		recordAuditNow(AuditActorController, AuditActionBaotaDeleteProxy, host, "删除策略 "+policy+"，所属路由 "+owner+" 已不再声明该域名", record.TargetURL, "", err)
+	case DeletionPolicyDeleteSite:
+		updateProgress(host, "⏳ 正在删除宝塔站点...")
+		err = DeleteBaotaSite(cfg, host)
+		recordAuditNow(AuditActorController, AuditActionBaotaDeleteSite, host, "删除策略 "+policy+"，所属路由 "+owner+" 已不再声明该域名", record.TargetURL, "", err)
+	}
+	updateProgress(host, "")
+	recordHistory(host, owner, policy, err)
+
+	if err != nil {
+		return fmt.Errorf("执行删除策略 %s 失败: %w", policy, err)
+	}
+	// retain 保留宝塔站点，公网记录也一并保留
+	if policy != DeletionPolicyRetain {
+		removeDNSRecord(host, owner)
+	}
+	slog.Info("已解除监控，删除策略执行完毕", "host", host, "namespace", record.Namespace, "ingress", record.Ingress, "action", policy)
+	return nil
+}
+
+// syncOnce 全量对账：执行宝塔端深度巡检，并把所有需要关注的域名投递进队列
 func syncOnce(clientset *kubernetes.Clientset, cfg Config) {
-	if !syncExecutionMutex.TryLock() { return }
-	defer syncExecutionMutex.Unlock()
+	resyncMutex.Lock()
+	defer resyncMutex.Unlock()
 
 	loopCount++
 	shouldDeepCheck := (loopCount == 1 || loopCount%10 == 0)
@@ -79,93 +445,65 @@ func syncOnce(clientset *kubernetes.Clientset, cfg Config) {
 	baotaFetchSuccess := false
 
 	if shouldDeepCheck {
-		resp, err := CallBaotaAPI(cfg, "/data?action=getData", map[string]string{"table": "sites", "limit": "1000"})
-		if err == nil {
-			var res map[string]interface{}
-			if json.Unmarshal([]byte(resp), &res) == nil {
-				if dataArr, ok := res["data"].([]interface{}); ok {
-					baotaFetchSuccess = true
-					for _, item := range dataArr {
-						if site, ok := item.(map[string]interface{}); ok {
-							if name, ok := site["name"].(string); ok { baotaSites[name] = true }
-						}
-					}
-				}
-			}
+		if sites, err := listBaotaSites(cfg); err == nil {
+			baotaSites, baotaFetchSuccess = sites, true
+		} else {
+			slog.Warn("获取宝塔站点列表失败，跳过本轮深度巡检", "error", err)
 		}
 	}
 
-	ingresses, err := clientset.NetworkingV1().Ingresses("").List(context.TODO(), metav1.ListOptions{})
+	// 每轮全量对账重新 List 一次，本轮投递的域名共用这份快照
+	invalidateRouteSnapshot()
+	ingresses, err := snapshotRoutes(clientset, cfg)
 	if err != nil { return }
 
-	var targets []ProxyTarget
 	currentDomains := make(map[string]bool)
 
-	for _, ing := range ingresses.Items {
-		if val, ok := ing.Annotations["kube-bt-sync.io/baota-sync"]; ok && val == "true" {
-			targetPort := cfg.DefaultPort
-			if customPort, hasCustom := ing.Annotations["kube-bt-sync.io/ddns-port"]; hasCustom && customPort != "" { targetPort = customPort }
-
-			targetURL := fmt.Sprintf("http://%s:%s", cfg.DDNSHost, targetPort)
+	for _, ing := range ingresses {
+		enqueueFinalize(ing)
+		if wantsSync(cfg, ing) {
 			for _, rule := range ing.Spec.Rules {
 				if rule.Host != "" {
 					cacheMutex.RLock()
 					_, existsInCache := syncedCache[rule.Host]
 					cacheMutex.RUnlock()
 
-					if shouldDeepCheck && existsInCache && baotaFetchSuccess && !baotaSites[rule.Host] {
-						updateProgress(rule.Host, "⏳ 宝塔端缺失，正在反向清理 K8s...")
-						clientset.NetworkingV1().Ingresses(ing.Namespace).Delete(context.TODO(), ing.Name, metav1.DeleteOptions{})
-						cacheMutex.Lock()
-						delete(syncedCache, rule.Host)
-						cacheMutex.Unlock()
-						updateProgress(rule.Host, "") // 清除进度
-						continue
+					if shouldDeepCheck && existsInCache && baotaFetchSuccess {
+						if !baotaSites[rule.Host] {
+							if handleMissingSite(clientset, cfg, ing, rule.Host) {
+								break // Ingress 已被删除，其余域名交给 finalizer / 删除事件处理
+							}
+						} else {
+							resetMissingCount(rule.Host)
+						}
 					}
 
-					targets = append(targets, ProxyTarget{Domain: rule.Host, TargetURL: targetURL})
+					syncQueue.Add(rule.Host)
 					currentDomains[rule.Host] = true
 				}
 			}
 		}
 	}
 
-	for _, target := range targets {
-		cacheMutex.RLock()
-		cachedURL, exists := syncedCache[target.Domain]
-		cacheMutex.RUnlock()
-
-		if exists && cachedURL == target.TargetURL { continue }
-
-		// 【核心升级】执行带实时进度反馈的底层操作
-		success := ensureBaotaSiteAndProxy(cfg, target)
-		
-		if success {
-			cacheMutex.Lock()
-			syncedCache[target.Domain] = target.TargetURL
-			cacheMutex.Unlock()
-		} else {
-			cacheMutex.Lock()
-			delete(syncedCache, target.Domain)
-			cacheMutex.Unlock()
-		}
-		
-		// 无论成功失败，结束时清空该域名的进度条显示
-		updateProgress(target.Domain, "")
-	}
-
-	cacheMutex.Lock()
+	// 缓存中存在但集群里已不再声明的域名，同样投递给队列，由消费者统一清理
+	cacheMutex.RLock()
 	for domain := range syncedCache {
-		if !currentDomains[domain] { delete(syncedCache, domain) }
+		if !currentDomains[domain] { syncQueue.Add(domain) }
 	}
-	cacheMutex.Unlock()
+	cacheMutex.RUnlock()
+
+	// 拉取宝塔端实时反代配置，修复面板上的手动改动
+	checkDrift(cfg, currentDomains)
+
+	requestSyncStateSave()
 }
 
-func ensureBaotaSiteAndProxy(cfg Config, target ProxyTarget) bool {
+func ensureBaotaSiteAndProxy(cfg Config, target ProxyTarget) error {
 	webnameMap := map[string]interface{}{"domain": target.Domain, "domainlist": []string{}, "count": 0}
 	webnameJSON, _ := json.Marshal(webnameMap)
 
-	// 👉 进度 1
+	// 👉 进度 1：建站会重载 Nginx，与同一面板上的其它域名串行执行
+	unlock := lockPanel(cfg, target.Domain)
 	updateProgress(target.Domain, "⏳ [1/2] 正在调用 API 创建站点...")
 	CallBaotaAPI(cfg, "/site?action=AddSite", map[string]string{
 		"webname": string(webnameJSON),
@@ -174,15 +512,29 @@ func ensureBaotaSiteAndProxy(cfg Config, target ProxyTarget) bool {
 		"ps":      "[kube-bt-sync]",
 	})
 
-	// 👉 进度 2：展示节流等待状态
-	updateProgress(target.Domain, "⏳ 防抖缓冲中 (防止 Nginx 假死)...")
-	time.Sleep(1500 * time.Millisecond)
+	// 👉 进度 2：轮询确认站点真正建好 (站点已存在时立即通过)，再放行下一个重载
+	updateProgress(target.Domain, "⏳ 等待宝塔站点就绪...")
+	err := waitForBaota(cfg, "宝塔站点就绪", func() (bool, error) {
+		_, found, err := findBaotaSiteID(cfg, target.Domain)
+		return found, err
+	})
+	unlock()
+	if err != nil {
+		updateProgress(target.Domain, "❌ 宝塔站点未就绪")
+		time.Sleep(2 * time.Second) // 停留两秒让用户看清报错
+		return err
+	}
 
-	// 👉 进度 3
+	// 👉 进度 3：反代规则已存在 (目标变更、漂移修复) 时改用 ModifyProxy，否则宝塔会提示名称重复
+	action := "CreateProxy"
+	if existing, lookupErr := getBaotaProxy(cfg, target.Domain); lookupErr == nil && existing != nil {
+		action = "ModifyProxy"
+	}
+	unlock = lockPanel(cfg, target.Domain)
 	updateProgress(target.Domain, "⏳ [2/2] 正在注入后端反向代理规则...")
-	resp, err := CallBaotaAPI(cfg, "/site?action=CreateProxy", map[string]string{
+	resp, err := CallBaotaAPI(cfg, "/site?action="+action, map[string]string{
 		"sitename":  target.Domain,
-		"proxyname": "kube-bt-sync-proxy",
+		"proxyname": ProxyName,
 		"proxydir":  "/",
 		"proxysite": target.TargetURL,
 		"todomain":  "$host",
@@ -193,19 +545,110 @@ func ensureBaotaSiteAndProxy(cfg Config, target ProxyTarget) bool {
 		"subfilter": `[{"sub1":"","sub2":""},{"sub1":"","sub2":""},{"sub1":"","sub2":""}]`, 
 	})
 
+	if err == nil && !isBaotaError(resp) {
+		// 👉 进度 4：轮询确认反代规则已指向新目标，确认前不放行下一个域名的重载
+		updateProgress(target.Domain, "⏳ 等待面板重载并确认反代规则...")
+		err = waitForBaota(cfg, "反代规则生效", func() (bool, error) {
+			proxy, err := getBaotaProxy(cfg, target.Domain)
+			return proxy != nil && strings.TrimRight(proxy.ProxySite, "/") == strings.TrimRight(target.TargetURL, "/"), err
+		})
+		if err == nil {
+			// 👉 进度 5：宝塔每次下发反代都会重写配置文件，需要重新补上 SNI / 证书校验与访问控制
+			updateProgress(target.Domain, "⏳ 正在写入反代扩展配置...")
+			err = applyProxyConf(cfg, target.Domain, target.Upstream, target.Access)
+		}
+		if err == nil && target.SSLMode != SSLModeNone && target.SSLMode != "" {
+			// 👉 进度 6：按 SSL 模式申请证书 / 切换强制 HTTPS
+			updateProgress(target.Domain, "⏳ 正在配置站点 SSL 证书...")
+			err = ensureBaotaSSL(cfg, target.Domain, target.SSLMode)
+		}
+		if err != nil {
+			unlock()
+			updateProgress(target.Domain, "❌ 反代规则未生效")
+			time.Sleep(2 * time.Second)
+			return err
+		}
+	}
+	unlock()
+
 	if err != nil {
 		updateProgress(target.Domain, "❌ 反代请求发送失败")
 		time.Sleep(2 * time.Second) // 停留两秒让用户看清报错
-		return false
-	} else if strings.Contains(resp, "错误") || strings.Contains(resp, "失败") || strings.Contains(resp, "error") {
+		return fmt.Errorf("反代请求发送失败: %w", err)
+	} else if isBaotaError(resp) {
 		updateProgress(target.Domain, "❌ 宝塔 API 拒绝请求")
 		time.Sleep(2 * time.Second)
-		return false
+		return fmt.Errorf("宝塔 API 拒绝请求: %s", resp)
 	}
+	return nil
+}
 
-	// 👉 进度 4：收尾冷却期
-	updateProgress(target.Domain, "⏳ 触发面板平滑重载 (冷却 3s)...")
-	time.Sleep(3 * time.Second)
+// handleMissingSite 深度巡检发现已同步的域名在宝塔端缺失时，按 MISSING_SITE_POLICY 处理
+// 返回 true 表示所属 Ingress 已被删除
+func handleMissingSite(clientset *kubernetes.Clientset, cfg Config, ing networkingv1.Ingress, host string) bool {
+	owner := ing.Namespace + "/" + ing.Name
 
-	return true
+	switch cfg.MissingSitePolicy {
+	case MissingSitePolicyReport:
+		slog.Warn("宝塔端站点缺失 (策略 report，仅报告漂移)", "host", host, "namespace", ing.Namespace, "ingress", ing.Name, "action", "site-missing")
+		recordHistory(host, owner, "site-missing", fmt.Errorf("宝塔端站点缺失，未做任何处理"))
+		return false
+
+	case MissingSitePolicyDeleteIngress:
+		cacheMutex.Lock()
+		missingCounts[host]++
+		count := missingCounts[host]
+		cacheMutex.Unlock()
+
+		if count < cfg.MissingSiteConfirmations {
+			slog.Warn("宝塔端站点缺失，等待再次确认", "host", host, "namespace", ing.Namespace, "ingress", ing.Name, "action", "site-missing", "count", count, "confirmations", cfg.MissingSiteConfirmations)
+			recordHistory(host, owner, "site-missing", fmt.Errorf("宝塔端站点缺失，确认 %d/%d", count, cfg.MissingSiteConfirmations))
+			return false
+		}
+
+		if cfg.DryRun {
+			slog.Info("[dry-run] 宝塔端站点连续缺失，将删除路由", "host", host, "kind", routeKind(ing), "namespace", ing.Namespace, "ingress", ing.Name, "action", "delete-ingress", "count", count)
+			recordHistoryNote(host, owner, "dry-run", "将执行: delete-ingress (宝塔端站点连续缺失)")
+			return false
+		}
+
+		updateProgress(host, "⏳ 宝塔端缺失，正在反向清理 K8s...")
+		before := ""
+		if routeKind(ing) == KindIngress {
+			before, _ = exportIngressYAML(ing.DeepCopy())
+		}
+		err := deleteRoute(clientset, routeKind(ing), ing.Namespace, ing.Name)
+		// 【审计】破坏性操作，无论成败都要留痕
+		recordAuditNow(AuditActorController, AuditActionRouteReverseDelete, routeTarget(routeKind(ing), ing.Namespace, ing.Name),
+			fmt.Sprintf("宝塔端连续 %d 次缺失站点 %s", count, host), before, "", err)
+		recordHistory(host, owner, "delete-ingress", err)
+		updateProgress(host, "") // 清除进度
+		if err != nil {
+			return false
+		}
+		cacheMutex.Lock()
+		delete(syncedCache, host)
+		delete(missingCounts, host)
+		cacheMutex.Unlock()
+		return true
+
+	default: // MissingSitePolicyRecreate
+		if cfg.DryRun {
+			slog.Info("[dry-run] 宝塔端站点缺失，将重新创建", "host", host, "namespace", ing.Namespace, "ingress", ing.Name, "action", "site-missing")
+			recordHistoryNote(host, owner, "dry-run", "将执行: create (宝塔端站点缺失)")
+			return false
+		}
+		slog.Warn("宝塔端站点缺失，重新创建", "host", host, "namespace", ing.Namespace, "ingress", ing.Name, "action", "site-missing")
+		recordHistoryNote(host, owner, "site-missing", "宝塔端站点缺失，已重新加入同步队列")
+		cacheMutex.Lock()
+		delete(syncedCache, host)
+		cacheMutex.Unlock()
+		return false
+	}
+}
+
+func resetMissingCount(host string) {
+	cacheMutex.Lock()
+	delete(missingCounts, host)
+	cacheMutex.Unlock()
 }
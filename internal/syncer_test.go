@@ -0,0 +1,24 @@
+package internal
+
+import "testing"
+
+func TestParseDeletionPolicy(t *testing.T) {
+	cases := []struct {
+		annotations map[string]string
+		want        string
+	}{
+		{nil, DeletionPolicyRetain},
+		{map[string]string{"kube-bt-sync.io/deletion-policy": ""}, DeletionPolicyRetain},
+		{map[string]string{"kube-bt-sync.io/deletion-policy": "retain"}, DeletionPolicyRetain},
+		{map[string]string{"kube-bt-sync.io/deletion-policy": "delete-proxy"}, DeletionPolicyDeleteProxy},
+		{map[string]string{"kube-bt-sync.io/deletion-policy": "delete-site"}, DeletionPolicyDeleteSite},
+		// 写错或大小写不符时回退为 retain，不能误删
+		{map[string]string{"kube-bt-sync.io/deletion-policy": "Delete-Site"}, DeletionPolicyRetain},
+		{map[string]string{"kube-bt-sync.io/deletion-policy": "delete"}, DeletionPolicyRetain},
+	}
+	for _, c := range cases {
+		if got := parseDeletionPolicy(testRoute("web", "www.example.com", c.annotations)); got != c.want {
+			t.Errorf("parseDeletionPolicy(%v) = %q, want %q", c.annotations, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package internal
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// 反代上游覆盖注解：默认反代到 http://<DDNS_HOST>:<DEFAULT_PORT>
+const (
+	upstreamPortAnnotation      = "kube-bt-sync.io/ddns-port"
+	upstreamHostAnnotation      = "kube-bt-sync.io/upstream-host"       // 例如第二个家庭站点的 DDNS 域名或固定 IP
+	upstreamSchemeAnnotation    = "kube-bt-sync.io/upstream-scheme"     // http (默认) / https
+	upstreamVerifyTLSAnnotation = "kube-bt-sync.io/upstream-verify-tls" // https 时是否校验家庭 Ingress 的证书，默认 false
+)
+
+// Upstream 宝塔反代到家庭网络的上游地址
+type Upstream struct {
+	Scheme    string
+	Host      string
+	Port      string
+	VerifyTLS bool
+}
+
+// URL 宝塔反代规则中的 proxysite
+func (u Upstream) URL() string {
+	return fmt.Sprintf("%s://%s", u.Scheme, net.JoinHostPort(u.Host, u.Port))
+}
+
+// parseUpstream 读取并校验上游覆盖注解，https 上游未指定端口时使用 HTTPS_PORT
+func parseUpstream(cfg Config, ing networkingv1.Ingress) (Upstream, error) {
+	up := Upstream{Scheme: "http", Host: cfg.DDNSHost, Port: cfg.DefaultPort}
+
+	if scheme, ok := ing.Annotations[upstreamSchemeAnnotation]; ok && scheme != "" {
+		switch scheme = strings.ToLower(scheme); scheme {
+		case "http":
+		case "https":
+			up.Scheme, up.Port = "https", cfg.HTTPSPort
+		default:
+			return up, fmt.Errorf("%s=%q 无效，只支持 http / https", upstreamSchemeAnnotation, scheme)
+		}
+	}
+
+	if host, ok := ing.Annotations[upstreamHostAnnotation]; ok && host != "" {
+		host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+		if net.ParseIP(host) == nil {
+			if errs := validation.IsDNS1123Subdomain(host); len(errs) > 0 {
+				return up, fmt.Errorf("%s=%q 不是合法的域名或 IP: %s", upstreamHostAnnotation, host, strings.Join(errs, "; "))
+			}
+		}
+		up.Host = host
+	}
+
+	if port, ok := ing.Annotations[upstreamPortAnnotation]; ok && port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return up, fmt.Errorf("%s=%q 不是合法的端口", upstreamPortAnnotation, port)
+		}
+		up.Port = port
+	}
+
+	if verify, ok := ing.Annotations[upstreamVerifyTLSAnnotation]; ok && verify != "" {
+		switch verify {
+		case "true":
+			if up.Scheme != "https" {
+				return up, fmt.Errorf("%s 只能与 %s=https 一起使用", upstreamVerifyTLSAnnotation, upstreamSchemeAnnotation)
+			}
+			up.VerifyTLS = true
+		case "false":
+		default:
+			return up, fmt.Errorf("%s=%q 无效，只支持 true / false", upstreamVerifyTLSAnnotation, verify)
+		}
+	}
+	return up, nil
+}
+
+// 宝塔站点侧的选项注解 (EdgeRoute 的 sslMode / access 字段同样转换为这些注解)
+const (
+	sslModeAnnotation  = "kube-bt-sync.io/ssl-mode"  // none (默认) / letsencrypt / force-https
+	allowIPsAnnotation = "kube-bt-sync.io/allow-ips" // 逗号分隔的 IP / CIDR，填写后其余来源一律拒绝
+	denyIPsAnnotation  = "kube-bt-sync.io/deny-ips"  // 逗号分隔的 IP / CIDR
+)
+
+// SSL 模式：宝塔站点对外的证书处理方式
+const (
+	SSLModeNone        = "none"        // 不触碰站点的 SSL 配置 (默认，与历史行为一致)
+	SSLModeLetsEncrypt = "letsencrypt" // 申请 Let's Encrypt 证书，HTTP 与 HTTPS 同时可用
+	SSLModeForceHTTPS  = "force-https" // 申请证书并开启强制 HTTPS
+)
+
+// parseSSLMode 读取并校验 SSL 模式注解
+func parseSSLMode(ing networkingv1.Ingress) (string, error) {
+	mode, ok := ing.Annotations[sslModeAnnotation]
+	if !ok || mode == "" {
+		return SSLModeNone, nil
+	}
+	switch mode {
+	case SSLModeNone, SSLModeLetsEncrypt, SSLModeForceHTTPS:
+		return mode, nil
+	}
+	return SSLModeNone, fmt.Errorf("%s=%q 无效，只支持 %s / %s / %s", sslModeAnnotation, mode, SSLModeNone, SSLModeLetsEncrypt, SSLModeForceHTTPS)
+}
+
+// AccessRules 宝塔反代上的来源 IP 访问控制
+type AccessRules struct {
+	Allow []string
+	Deny  []string
+}
+
+func (a AccessRules) Empty() bool {
+	return len(a.Allow) == 0 && len(a.Deny) == 0
+}
+
+// directives 生成 Nginx 指令：Nginx 按顺序匹配，先拒绝黑名单，再放行白名单，有白名单时拒绝其余来源
+func (a AccessRules) directives() []string {
+	var lines []string
+	for _, ip := range a.Deny {
+		lines = append(lines, "deny "+ip+";")
+	}
+	for _, ip := range a.Allow {
+		lines = append(lines, "allow "+ip+";")
+	}
+	if len(a.Allow) > 0 {
+		lines = append(lines, "deny all;")
+	}
+	return lines
+}
+
+// parseAccessRules 读取并校验访问控制注解，每一项必须是 IP 或 CIDR
+func parseAccessRules(ing networkingv1.Ingress) (AccessRules, error) {
+	var rules AccessRules
+	var err error
+	if rules.Allow, err = parseIPList(ing, allowIPsAnnotation); err != nil {
+		return rules, err
+	}
+	rules.Deny, err = parseIPList(ing, denyIPsAnnotation)
+	return rules, err
+}
+
+func parseIPList(ing networkingv1.Ingress, annotation string) ([]string, error) {
+	var list []string
+	for _, item := range strings.Split(ing.Annotations[annotation], ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if net.ParseIP(item) == nil {
+			if _, _, err := net.ParseCIDR(item); err != nil {
+				return nil, fmt.Errorf("%s 中的 %q 不是合法的 IP 或 CIDR", annotation, item)
+			}
+		}
+		list = append(list, item)
+	}
+	return list, nil
+}
+
+// parseProxyOptions 一次性解析路由上所有影响宝塔配置的注解，返回遇到的第一个错误
+func parseProxyOptions(cfg Config, ing networkingv1.Ingress) (Upstream, string, AccessRules, error) {
+	up, err := parseUpstream(cfg, ing)
+	if err != nil {
+		return up, SSLModeNone, AccessRules{}, err
+	}
+	mode, err := parseSSLMode(ing)
+	if err != nil {
+		return up, mode, AccessRules{}, err
+	}
+	access, err := parseAccessRules(ing)
+	if err != nil {
+		return up, mode, access, err
+	}
+	if msg := ing.Annotations[routeConfigErrorAnnotation]; msg != "" {
+		return up, mode, access, fmt.Errorf("%s", msg)
+	}
+	return up, mode, access, nil
+}
@@ -0,0 +1,40 @@
+package internal
+
+import "testing"
+
+func TestParseUpstream(t *testing.T) {
+	cfg := Config{DDNSHost: "home.example.com", DefaultPort: "8080", HTTPSPort: "8443"}
+	cases := []struct {
+		annotations map[string]string
+		want        string // 期望的 URL，为空表示应返回错误
+		verifyTLS   bool
+	}{
+		{nil, "http://home.example.com:8080", false},
+		{map[string]string{upstreamSchemeAnnotation: "HTTPS"}, "https://home.example.com:8443", false},
+		{map[string]string{upstreamSchemeAnnotation: "https", upstreamPortAnnotation: "9443"}, "https://home.example.com:9443", false},
+		{map[string]string{upstreamHostAnnotation: "second.example.com"}, "http://second.example.com:8080", false},
+		{map[string]string{upstreamHostAnnotation: "[2001:db8::1]"}, "http://[2001:db8::1]:8080", false},
+		{map[string]string{upstreamSchemeAnnotation: "https", upstreamVerifyTLSAnnotation: "true"}, "https://home.example.com:8443", true},
+		{map[string]string{upstreamSchemeAnnotation: "ftp"}, "", false},
+		{map[string]string{upstreamHostAnnotation: "bad_host!"}, "", false},
+		{map[string]string{upstreamPortAnnotation: "70000"}, "", false},
+		{map[string]string{upstreamVerifyTLSAnnotation: "true"}, "", false},
+		{map[string]string{upstreamSchemeAnnotation: "https", upstreamVerifyTLSAnnotation: "yes"}, "", false},
+	}
+	for _, c := range cases {
+		up, err := parseUpstream(cfg, testRoute("web", "www.example.com", c.annotations))
+		if c.want == "" {
+			if err == nil {
+				t.Errorf("parseUpstream(%v) 应返回错误，得到 %s", c.annotations, up.URL())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseUpstream(%v): %v", c.annotations, err)
+			continue
+		}
+		if up.URL() != c.want || up.VerifyTLS != c.verifyTLS {
+			t.Errorf("parseUpstream(%v) = %s verify=%v, want %s verify=%v", c.annotations, up.URL(), up.VerifyTLS, c.want, c.verifyTLS)
+		}
+	}
+}
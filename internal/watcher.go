@@ -2,7 +2,7 @@ package internal
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"time"
 
 	networkingv1 "k8s.io/api/networking/v1"
@@ -11,43 +11,74 @@ import (
 )
 
 // StartIngressWatcher 启动纯事件驱动的监听器
+// 限定了命名空间时为每个命名空间单独建立监听，只需要命名空间级别的 Role 权限
 func StartIngressWatcher(k8sClient *kubernetes.Clientset, cfg Config) {
-	log.Println("👀 K8s 事件雷达已开启，正在静默监听 Ingress 变动...")
+	slog.Info("K8s 事件监听器已启动", "namespaces", cfg.WatchNamespaces)
 
+	namespaces := scopedNamespaces(cfg)
+	if gatewayAPIEnabled() {
+		for _, ns := range namespaces {
+			go watchHTTPRoutes(k8sClient, cfg, ns)
+		}
+	}
+	if edgeRoutesEnabled() {
+		for _, ns := range namespaces {
+			go watchEdgeRoutes(k8sClient, cfg, ns)
+		}
+	}
+	for _, ns := range namespaces[1:] {
+		go watchIngresses(k8sClient, cfg, ns)
+	}
+	watchIngresses(k8sClient, cfg, namespaces[0])
+}
+
+func watchIngresses(k8sClient *kubernetes.Clientset, cfg Config, namespace string) {
 	for {
-		// 监听所有 Namespace 下的 Ingress
-		watcher, err := k8sClient.NetworkingV1().Ingresses("").Watch(context.TODO(), metav1.ListOptions{})
+		// namespace 为空时监听所有 Namespace 下的 Ingress
+		watcher, err := k8sClient.NetworkingV1().Ingresses(namespace).Watch(context.TODO(), metav1.ListOptions{LabelSelector: cfg.LabelSelector})
 		if err != nil {
-			log.Printf("❌ 监听 Ingress 失败，5秒后重试: %v\n", err)
+			slog.Error("监听 Ingress 失败，5秒后重试", "kind", KindIngress, "namespace", namespace, "error", err)
+			watchReconnects.WithLabelValues("Ingress", "error").Inc()
 			time.Sleep(5 * time.Second)
 			continue
 		}
 
+		// 每次（重新）建立监听后做一次全量对账，弥补断线期间可能漏掉的事件
+		TriggerSync(k8sClient, cfg)
+
 		// 处理管道中源源不断涌来的事件
 		for event := range watcher.ResultChan() {
 			ing, ok := event.Object.(*networkingv1.Ingress)
 			if !ok {
 				continue
 			}
+			invalidateRouteSnapshot()
 
-			// 严格过滤：只处理带有我们特有 Annotation 的 Ingress
-			if val, ok := ing.Annotations["kube-bt-sync.io/baota-sync"]; !ok || val != "true" {
+			// 严格过滤：只处理带有我们特有 Annotation 且 class 匹配 (或此前由我们下发过) 的 Ingress
+			if !IsManagedIngress(cfg, ing) {
 				continue
 			}
 
 			switch event.Type {
 			case "ADDED":
-				log.Printf("✨ [事件拦截] 检测到新增 Ingress [%s/%s]，触发一次性同步...", ing.Namespace, ing.Name)
-				TriggerSync(k8sClient, cfg)
+				slog.Info("检测到新增路由，已加入同步队列", "kind", KindIngress, "namespace", ing.Namespace, "ingress", ing.Name, "event", event.Type)
+				EnqueueIngress(ing)
 			case "MODIFIED":
-				log.Printf("🔄 [事件拦截] 检测到修改 Ingress [%s/%s]，触发一次性同步...", ing.Namespace, ing.Name)
-				TriggerSync(k8sClient, cfg)
+				slog.Info("检测到修改路由，已加入同步队列", "kind", KindIngress, "namespace", ing.Namespace, "ingress", ing.Name, "event", event.Type)
+				EnqueueIngress(ing)
 			case "DELETED":
-				log.Printf("🗑️ [事件拦截] 检测到删除 Ingress [%s/%s]，已解除监控", ing.Namespace, ing.Name)
+				// 标签被改走时同样会收到 DELETED，先确认路由是否真的被删除 (最终以同步引擎的判断为准)
+				if left, err := routeLeftScope(k8sClient, cfg, KindIngress, ing.Namespace, ing.Name); err == nil && left {
+					slog.Info("路由已移出标签选择器范围，解除管理 (宝塔端保持不变)", "kind", KindIngress, "namespace", ing.Namespace, "ingress", ing.Name, "event", event.Type)
+				} else {
+					slog.Info("检测到删除路由，按删除策略清理宝塔端", "kind", KindIngress, "namespace", ing.Namespace, "ingress", ing.Name, "event", event.Type)
+				}
+				EnqueueIngress(ing)
 			}
 		}
 
 		// K8s API Server 可能会因为超时切断 Watch 连接，静默重连
+		watchReconnects.WithLabelValues("Ingress", "closed").Inc()
 		time.Sleep(2 * time.Second)
 	}
 }
@@ -2,9 +2,8 @@ package internal
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"os"
@@ -14,6 +13,7 @@ import (
 	"github.com/gin-gonic/gin"
 	networkingv1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/client-go/kubernetes"
 	"sigs.k8s.io/yaml"
 )
@@ -23,6 +23,7 @@ type YamlRequest struct {
 }
 
 type DeleteRequest struct {
+	Kind        string `json:"kind"` // Ingress (默认) / HTTPRoute / EdgeRoute
 	Namespace   string `json:"namespace" binding:"required"`
 	Name        string `json:"name" binding:"required"`
 	Domain      string `json:"domain" binding:"required"`
@@ -30,13 +31,16 @@ type DeleteRequest struct {
 }
 
 func StartWebServer(k8sClient *kubernetes.Clientset, cfg Config) {
-	r := gin.Default()
+	// 请求日志改由 slog 输出，与其它日志保持相同的格式
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.Use(ginLogger(), gin.Recovery())
 
 	authUser := os.Getenv("AUTH_USER")
 	authPass := os.Getenv("AUTH_PASSWORD")
 	if authUser != "" && authPass != "" {
 		r.Use(gin.BasicAuth(gin.Accounts{authUser: authPass}))
-		log.Printf("🔒 Web 控制台已开启安全认证")
+		slog.Info("Web 控制台已开启安全认证", "user", authUser)
 	}
 
 	r.Delims("[[", "]]")
@@ -50,21 +54,37 @@ func StartWebServer(k8sClient *kubernetes.Clientset, cfg Config) {
 		api.POST("/ingress/yaml", func(c *gin.Context) { handleApplyYaml(c, k8sClient, cfg) })
 		api.POST("/ingress/delete", func(c *gin.Context) { handleDeleteIngress(c, k8sClient, cfg) })
 		api.GET("/system/check", func(c *gin.Context) { handleSystemCheck(c, k8sClient, cfg) })
-		api.GET("/namespaces", func(c *gin.Context) { handleGetNamespaces(c, k8sClient) })
-		api.GET("/services", func(c *gin.Context) { handleGetServices(c, k8sClient) })
-		api.GET("/ingress/raw", func(c *gin.Context) { handleGetRawIngress(c, k8sClient) })
+		api.GET("/namespaces", func(c *gin.Context) { handleGetNamespaces(c, k8sClient, cfg) })
+		api.GET("/services", func(c *gin.Context) { handleGetServices(c, k8sClient, cfg) })
+		api.GET("/ingress/raw", func(c *gin.Context) { handleGetRawIngress(c, k8sClient, cfg) })
+		api.GET("/sync/history", func(c *gin.Context) { c.JSON(200, GetSyncHistory()) })
+		api.GET("/plan", func(c *gin.Context) { handleGetPlan(c, k8sClient, cfg) })
+		api.POST("/probe", func(c *gin.Context) { handleProbe(c, k8sClient, cfg) })
+		api.GET("/revisions", func(c *gin.Context) { handleGetRevisions(c, k8sClient, cfg) })
+		api.GET("/revisions/diff", func(c *gin.Context) { handleDiffRevisions(c, k8sClient, cfg) })
+		api.POST("/revisions/rollback", func(c *gin.Context) { handleRollbackRoute(c, k8sClient, cfg) })
+		api.GET("/audit", func(c *gin.Context) { handleGetAudit(c, k8sClient, cfg) })
 	}
 
-	log.Println("kube-bt-sync Dashboard 已启动，监听 :8080")
+	slog.Info("kube-bt-sync Dashboard 已启动", "addr", ":8080")
 	r.Run(":8080")
 }
 
-func handleGetRawIngress(c *gin.Context, k8sClient *kubernetes.Clientset) {
+func handleGetRawIngress(c *gin.Context, k8sClient *kubernetes.Clientset, cfg Config) {
 	ns := c.Query("ns")
 	name := c.Query("name")
+	if !namespaceInScope(cfg, ns) { c.JSON(403, gin.H{"error": "命名空间不在本实例的管理范围内"}); return }
+	if kind := normalizeKind(c.Query("kind")); kind != KindIngress { handleGetRawDynamicRoute(c, kind, ns, name); return }
 	ing, err := k8sClient.NetworkingV1().Ingresses(ns).Get(context.TODO(), name, metav1.GetOptions{})
 	if err != nil { c.JSON(500, gin.H{"error": err.Error()}); return }
 
+	yamlData, err := exportIngressYAML(ing)
+	if err != nil { c.JSON(500, gin.H{"error": "YAML 转换失败"}); return }
+	c.String(200, yamlData)
+}
+
+// exportIngressYAML 去掉集群维护的字段，得到可以直接编辑后重新下发的 YAML
+func exportIngressYAML(ing *networkingv1.Ingress) (string, error) {
 	ing.ManagedFields = nil
 	ing.Status = networkingv1.IngressStatus{}
 	ing.ResourceVersion = ""
@@ -73,31 +93,89 @@ func handleGetRawIngress(c *gin.Context, k8sClient *kubernetes.Clientset) {
 	ing.Generation = 0
 
 	yamlData, err := yaml.Marshal(ing)
+	return string(yamlData), err
+}
+
+// handleGetRawDynamicRoute HTTPRoute / EdgeRoute 的原始 YAML
+func handleGetRawDynamicRoute(c *gin.Context, kind, ns, name string) {
+	if _, ok := dynamicRouteVersion(kind); !ok { c.JSON(400, gin.H{"error": "集群未启用 " + kind}); return }
+	client, _ := dynamicRoute(kind, ns)
+	u, err := client.Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil { c.JSON(500, gin.H{"error": err.Error()}); return }
+
+	yamlData, err := exportDynamicRouteYAML(u)
 	if err != nil { c.JSON(500, gin.H{"error": "YAML 转换失败"}); return }
-	c.String(200, string(yamlData))
+	c.String(200, yamlData)
+}
+
+// exportRouteYAML 读取路由当前的 YAML 作为审计快照，读取失败时返回空
+func exportRouteYAML(k8sClient *kubernetes.Clientset, kind, ns, name string) string {
+	if kind == KindIngress {
+		ing, err := k8sClient.NetworkingV1().Ingresses(ns).Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil { return "" }
+		yamlData, _ := exportIngressYAML(ing)
+		return yamlData
+	}
+	client, _ := dynamicRoute(kind, ns)
+	u, err := client.Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil { return "" }
+	yamlData, _ := exportDynamicRouteYAML(u)
+	return yamlData
+}
+
+// exportDynamicRouteYAML 同 exportIngressYAML，用于 HTTPRoute / EdgeRoute
+func exportDynamicRouteYAML(u *unstructured.Unstructured) (string, error) {
+	u.SetManagedFields(nil)
+	u.SetResourceVersion("")
+	u.SetUID("")
+	u.SetCreationTimestamp(metav1.Time{})
+	u.SetGeneration(0)
+	delete(u.Object, "status")
+
+	yamlData, err := yaml.Marshal(u.Object)
+	return string(yamlData), err
+}
+
+func handleGetPlan(c *gin.Context, k8sClient *kubernetes.Clientset, cfg Config) {
+	plan, err := BuildPlan(k8sClient, cfg)
+	if err != nil { c.JSON(500, gin.H{"error": err.Error()}); return }
+	c.JSON(200, plan)
+}
+
+func handleProbe(c *gin.Context, k8sClient *kubernetes.Clientset, cfg Config) {
+	var req struct { Domain string `json:"domain"` }
+	if err := c.ShouldBindJSON(&req); err != nil || req.Domain == "" { c.JSON(400, gin.H{"error": "参数解析失败"}); return }
+
+	ingresses, err := listRoutes(k8sClient, cfg)
+	if err != nil { c.JSON(500, gin.H{"error": "获取路由列表失败: " + err.Error()}); return }
+	target, ok := collectTargets(cfg, ingresses)[req.Domain]
+	if !ok { c.JSON(404, gin.H{"error": "该域名未被任何同步中的 Ingress / HTTPRoute / EdgeRoute 声明"}); return }
+
+	c.JSON(200, ProbeHost(cfg, target.Domain, target.TargetURL, target.Namespace+"/"+target.Ingress))
 }
 
 func handleDeleteIngress(c *gin.Context, k8sClient *kubernetes.Clientset, cfg Config) {
 	var req DeleteRequest
 	if err := c.ShouldBindJSON(&req); err != nil { c.JSON(400, gin.H{"error": "参数解析失败"}); return }
-
-	if req.DeleteBaota {
-		resp, err := CallBaotaAPI(cfg, "/data?action=getData", map[string]string{"table": "sites", "search": req.Domain})
-		if err == nil {
-			var siteData struct { Data []struct { Id int `json:"id"`; Name string `json:"name"` } `json:"data"` }
-			if json.Unmarshal([]byte(resp), &siteData) == nil {
-				for _, site := range siteData.Data {
-					if site.Name == req.Domain {
-						CallBaotaAPI(cfg, "/site?action=DeleteSite", map[string]string{"id": fmt.Sprintf("%d", site.Id), "webname": req.Domain})
-						break
-					}
-				}
-			}
+	if !namespaceInScope(cfg, req.Namespace) { c.JSON(403, gin.H{"error": "命名空间不在本实例的管理范围内"}); return }
+
+	actor := requestActor(c)
+	if req.DeleteBaota && cfg.DryRun {
+		recordHistoryNote(req.Domain, req.Namespace+"/"+req.Name, "dry-run", "将执行: delete-site (控制台删除路由时一并删除)")
+	} else if req.DeleteBaota {
+		err := DeleteBaotaSite(cfg, req.Domain)
+		if err != nil {
+			slog.Warn("删除宝塔站点失败", "host", req.Domain, "action", "delete-site", "actor", actor, "error", err)
 		}
+		recordAuditNow(actor, AuditActionBaotaDeleteSite, req.Domain, "控制台删除路由时一并删除", "", "", err)
 	}
 
-	err := k8sClient.NetworkingV1().Ingresses(req.Namespace).Delete(context.TODO(), req.Name, metav1.DeleteOptions{})
-	if err != nil { c.JSON(500, gin.H{"error": "删除 K8s Ingress 失败: " + err.Error()}); return }
+	kind := normalizeKind(req.Kind)
+	if _, ok := dynamicRouteVersion(kind); kind != KindIngress && !ok { c.JSON(400, gin.H{"error": "集群未启用 " + kind}); return }
+	before := exportRouteYAML(k8sClient, kind, req.Namespace, req.Name)
+	err := deleteRoute(k8sClient, kind, req.Namespace, req.Name)
+	recordAuditNow(actor, AuditActionRouteDelete, routeTarget(kind, req.Namespace, req.Name), "", before, "", err)
+	if err != nil { c.JSON(500, gin.H{"error": "删除 K8s " + kind + " 失败: " + err.Error()}); return }
 	c.JSON(200, gin.H{"message": "路由删除成功！"})
 }
 
@@ -131,18 +209,19 @@ func handleSystemCheck(c *gin.Context, k8sClient *kubernetes.Clientset, cfg Conf
 	}
 
 	// 🌟 动态获取 HTTPS 端口，默认 443
-	httpsPort := os.Getenv("HTTPS_PORT")
+	httpsPort := cfg.HTTPSPort
 	if httpsPort == "" {
 		httpsPort = "443"
 	}
 
 	ddnsStatus, ddnsMsg := "error", "未配置 DDNS 域名或解析失败"
 	var resolvedIPs []string
-	cleanDDNS := strings.Split(strings.TrimPrefix(strings.TrimPrefix(cfg.DDNSHost, "http://"), "https://"), ":")[0]
+	cleanDDNS := ddnsHostname(cfg)
 	port443Status := false 
 
 	if cleanDDNS != "" {
 		ips, err := net.LookupIP(cleanDDNS)
+		if err == nil { observeDDNSIPs(cfg, ips) }
 		if err == nil {
 			for _, ip := range ips { if ipv4 := ip.To4(); ipv4 != nil { resolvedIPs = append(resolvedIPs, ipv4.String()) } }
 			if len(resolvedIPs) > 0 {
@@ -164,59 +243,115 @@ func handleSystemCheck(c *gin.Context, k8sClient *kubernetes.Clientset, cfg Conf
 		}
 	}
 
+	observeDDNSCheck(len(resolvedIPs) > 0, map[string]bool{cfg.DefaultPort: ddnsStatus == "success", httpsPort: port443Status})
+
 	c.JSON(200, gin.H{
-		"baota": gin.H{"status": baotaStatus, "msg": baotaMsg, "url": cfg.BaotaURL},
+		"baota": gin.H{"status": baotaStatus, "msg": baotaMsg, "url": cfg.BaotaURL, "dryRun": cfg.DryRun, "dnsProvider": DNSProviderName()},
+		"controller": gin.H{"leader": LeaderIdentity(), "self": cfg.PodName, "isLeader": IsLeader()},
 		"k8s":   gin.H{"ingressInstalled": ingressInstalled, "metallbInstalled": metallbInstalled, "nodeIP": nodeIP},
 		// 🌟 将 httpsPort 传递给前端
-		"ddns":  gin.H{"status": ddnsStatus, "msg": ddnsMsg, "host": cfg.DDNSHost, "ips": resolvedIPs, "port443": port443Status, "httpsPort": httpsPort},
+		"ddns":  gin.H{"status": ddnsStatus, "msg": ddnsMsg, "host": cfg.DDNSHost, "ips": resolvedIPs, "port443": port443Status, "httpsPort": httpsPort, "updater": GetDDNSUpdaterStatus(), "follow": ddnsFollowMode(cfg)},
 	})
 }
 
 func handleGetStatus(c *gin.Context, k8sClient *kubernetes.Clientset, cfg Config) {
-	ingresses, _ := k8sClient.NetworkingV1().Ingresses("").List(context.TODO(), metav1.ListOptions{})
+	ingresses, _ := listRoutes(k8sClient, cfg)
 	var result []map[string]interface{}
-	for _, ing := range ingresses.Items {
+	for _, ing := range ingresses {
 		if val, ok := ing.Annotations["kube-bt-sync.io/baota-sync"]; ok && val == "true" {
-			port := cfg.DefaultPort
-			if cp, ok := ing.Annotations["kube-bt-sync.io/ddns-port"]; ok && cp != "" { port = cp }
+			upstream, sslMode, _, optionsErr := parseProxyOptions(cfg, ing)
 			domain := "N/A"
-			if len(ing.Spec.Rules) > 0 { domain = ing.Spec.Rules[0].Host }
+			var paths []string
+			if len(ing.Spec.Rules) > 0 {
+				domain = ing.Spec.Rules[0].Host
+				if ing.Spec.Rules[0].HTTP != nil {
+					for _, p := range ing.Spec.Rules[0].HTTP.Paths { paths = append(paths, p.Path) }
+				}
+			}
 
 			scheme := "http"
-			if len(ing.Spec.TLS) > 0 { scheme = "https" }
+			if len(ing.Spec.TLS) > 0 || sslMode != SSLModeNone { scheme = "https" }
 
 			modifiedAt := ing.CreationTimestamp.Format("2006-01-02 15:04:05")
 			if mod, ok := ing.Annotations["kube-bt-sync.io/last-modified"]; ok { modifiedAt = mod }
 
+			// 优先展示实时进度，其次以写回 Ingress 的状态注解为准
+			targetURL := upstream.URL()
+			status, phase := GetSyncStatus(domain, targetURL), ""
+			if st, ok := readHostStatuses(ing)[domain]; ok && !IsSyncInProgress(domain) {
+				phase = st.Phase
+				switch {
+				case st.Phase == SyncPhaseFailed:
+					status = "❌ 同步失败: " + st.Error
+				case st.Phase == SyncPhaseSynced && st.Target == targetURL:
+					// 非 Leader 副本内存中没有同步记录，以注解为准
+					status = "✅ 已同步"
+				}
+			}
+
+			// IngressClass (HTTPRoute 为 Gateway) 不匹配的路由不会被同步，在控制台上给出提示
+			classWarning := ""
+			if !ingressClassMatches(cfg, ing) && routeKind(ing) == KindHTTPRoute {
+				gateways := strings.Join(routeGateways(ing), ", ")
+				if gateways == "" { gateways = "未声明" }
+				classWarning = fmt.Sprintf("挂载的 Gateway 为 %s，与本实例管理的 %s 不匹配，不会同步到宝塔", gateways, cfg.GatewayName)
+				status, phase = "⚠️ Gateway 不匹配", ""
+			} else if !ingressClassMatches(cfg, ing) {
+				class := effectiveIngressClass(ing)
+				if class == "" { class = "未声明" }
+				classWarning = fmt.Sprintf("IngressClass 为 %s，与本实例管理的 %s 不匹配，不会同步到宝塔", class, cfg.IngressClass)
+				status, phase = "⚠️ IngressClass 不匹配", ""
+			} else if optionsErr != nil && routeKind(ing) == KindEdgeRoute {
+				status, phase = "❌ 配置无效: "+optionsErr.Error(), SyncPhaseFailed
+			} else if optionsErr != nil {
+				status, phase = "❌ 注解无效: "+optionsErr.Error(), SyncPhaseFailed
+			}
+
+			var probe interface{}
+			if res, ok := GetProbeResult(domain); ok { probe = res }
+			var dnsStatus interface{}
+			if st, ok := GetDNSStatus(domain); ok { dnsStatus = st }
+
 			result = append(result, map[string]interface{}{
-				"namespace": ing.Namespace, "name": ing.Name, "domain": domain,
-				"scheme": scheme, "ddnsPort": port, 
+				"kind": routeKind(ing), "exposedService": ing.Labels[exposedServiceLabel], "namespace": ing.Namespace, "name": ing.Name, "domain": domain, "paths": paths,
+				"scheme": scheme, "ddnsPort": upstream.Port, "upstream": targetURL, "sslMode": sslMode,
 				"createdAt": ing.CreationTimestamp.Format("2006-01-02 15:04:05"),
 				"modifiedAt": modifiedAt,
 				"version": ing.ResourceVersion,
-				"status": "🟢 已下发 (事件守护中)",
+				"status": status,
+				"phase": phase,
+				"ingressClass": effectiveIngressClass(ing),
+				"classWarning": classWarning,
+				"probeEnabled": cfg.ProbeEnabled,
+				"probe": probe,
+				"dns": dnsStatus,
 			})
 		}
 	}
 	c.JSON(200, result)
 }
 
-func handleGetNamespaces(c *gin.Context, k8sClient *kubernetes.Clientset) {
+func handleGetNamespaces(c *gin.Context, k8sClient *kubernetes.Clientset, cfg Config) {
+	// 限定了管理范围时直接返回配置的命名空间，无需集群级别的 namespaces 权限
+	if len(cfg.WatchNamespaces) > 0 { c.JSON(200, cfg.WatchNamespaces); return }
+
 	nsList, _ := k8sClient.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{})
 	var result []string
 	for _, ns := range nsList.Items { result = append(result, ns.Name) }
 	c.JSON(200, result)
 }
 
-func handleGetServices(c *gin.Context, k8sClient *kubernetes.Clientset) {
-	services, _ := k8sClient.CoreV1().Services("").List(context.TODO(), metav1.ListOptions{})
+func handleGetServices(c *gin.Context, k8sClient *kubernetes.Clientset, cfg Config) {
 	var result []map[string]interface{}
-	for _, svc := range services.Items {
-		var ports []int32
-		for _, p := range svc.Spec.Ports { ports = append(ports, p.Port) }
-		ip := svc.Spec.ClusterIP
-		if len(svc.Status.LoadBalancer.Ingress) > 0 { ip = svc.Status.LoadBalancer.Ingress[0].IP }
-		result = append(result, map[string]interface{}{"name": svc.Name, "namespace": svc.Namespace, "ports": ports, "ip": ip})
+	for _, ns := range scopedNamespaces(cfg) {
+		services, _ := k8sClient.CoreV1().Services(ns).List(context.TODO(), metav1.ListOptions{})
+		for _, svc := range services.Items {
+			var ports []int32
+			for _, p := range svc.Spec.Ports { ports = append(ports, p.Port) }
+			ip := svc.Spec.ClusterIP
+			if len(svc.Status.LoadBalancer.Ingress) > 0 { ip = svc.Status.LoadBalancer.Ingress[0].IP }
+			result = append(result, map[string]interface{}{"name": svc.Name, "namespace": svc.Namespace, "ports": ports, "ip": ip})
+		}
 	}
 	c.JSON(200, result)
 }
@@ -225,9 +360,48 @@ func handleApplyYaml(c *gin.Context, k8sClient *kubernetes.Clientset, cfg Config
 	var req YamlRequest
 	if err := c.ShouldBindJSON(&req); err != nil { c.JSON(400, gin.H{"error": "参数解析失败"}); return }
 
+	applied, code, err := applyRouteYAML(k8sClient, cfg, req.YamlContent)
+	// 失败的下发同样留痕；YAML 无法解析时目标未知
+	target := "(YAML 无法解析)"
+	if applied.Name != "" { target = routeTarget(applied.Kind, applied.Namespace, applied.Name) }
+	recordAuditNow(requestActor(c), AuditActionRouteApply, target, "", applied.Previous, req.YamlContent, err)
+	if err != nil { c.JSON(code, gin.H{"error": err.Error()}); return }
+
+	message := "配置下发/修改成功！事件监听器已接管同步..."
+	if applied.Kind != KindIngress { message = applied.Kind + " 下发/修改成功！事件监听器已接管同步..." }
+	if rev, err := recordRevision(k8sClient, cfg, applied, requestActor(c), RevisionActionApply, "", req.YamlContent); err != nil {
+		message += " (修订记录保存失败: " + err.Error() + ")"
+	} else {
+		message += fmt.Sprintf(" (修订 #%d)", rev.Revision)
+	}
+	c.JSON(200, gin.H{"message": message})
+}
+
+// requestActor 操作人：开启 Basic Auth 时为登录用户名，否则记录来源 IP
+func requestActor(c *gin.Context) string {
+	if user := c.GetString(gin.AuthUserKey); user != "" { return user }
+	return "anonymous@" + c.ClientIP()
+}
+
+// applyRouteYAML 按 YAML 中的 kind 创建 / 更新 Ingress、HTTPRoute 或 EdgeRoute，失败时返回对应的 HTTP 状态码
+func applyRouteYAML(k8sClient *kubernetes.Clientset, cfg Config, content string) (appliedRoute, int, error) {
+	// 先只解析类型与名称：目标确定后即使下发失败也返回 applied，便于写入审计记录
+	var meta metav1.PartialObjectMetadata
+	if err := yaml.Unmarshal([]byte(content), &meta); err != nil { return appliedRoute{}, 400, fmt.Errorf("YAML 格式错误") }
+	if meta.Namespace == "" { meta.Namespace = "default" }
+	applied := appliedRoute{Kind: normalizeKind(meta.Kind), Namespace: meta.Namespace, Name: meta.Name}
+	if applied.Kind != KindIngress { return applyDynamicRouteYAML(cfg, applied, content) }
+
 	var ingress networkingv1.Ingress
-	if err := yaml.Unmarshal([]byte(req.YamlContent), &ingress); err != nil { c.JSON(400, gin.H{"error": "YAML 格式错误"}); return }
+	if err := yaml.Unmarshal([]byte(content), &ingress); err != nil { return applied, 400, fmt.Errorf("YAML 格式错误") }
 	if ingress.Namespace == "" { ingress.Namespace = "default" }
+	// 标签选择器只含等值条件时，控制台提交的路由自动补齐标签
+	ingress.Labels = withScopeLabels(cfg, ingress.Labels)
+	if !ingressInScope(cfg, &ingress) {
+		return applied, 400, fmt.Errorf("Ingress 不在本实例的管理范围内 (命名空间: %v, 标签选择器: %q)", cfg.WatchNamespaces, cfg.LabelSelector)
+	}
+
+	if _, _, _, err := parseProxyOptions(cfg, ingress); err != nil { return applied, 400, fmt.Errorf("注解无效: %w", err) }
 
 	if ingress.Annotations == nil { ingress.Annotations = make(map[string]string) }
 	ingress.Annotations["kube-bt-sync.io/last-modified"] = time.Now().Format("2006-01-02 15:04:05")
@@ -236,12 +410,135 @@ func handleApplyYaml(c *gin.Context, k8sClient *kubernetes.Clientset, cfg Config
 	existing, err := client.Get(context.TODO(), ingress.Name, metav1.GetOptions{})
 
 	if err == nil {
+		applied.Previous, _ = exportIngressYAML(existing.DeepCopy())
 		ingress.ResourceVersion = existing.ResourceVersion
+		// 覆盖时保留清理 finalizer，避免用户提交的 YAML 把它冲掉
+		if hasCleanupFinalizer(*existing) && !hasCleanupFinalizer(ingress) {
+			ingress.Finalizers = append(ingress.Finalizers, CleanupFinalizer)
+		}
 		_, err = client.Update(context.TODO(), &ingress, metav1.UpdateOptions{})
 	} else {
 		_, err = client.Create(context.TODO(), &ingress, metav1.CreateOptions{})
 	}
 
-	if err != nil { c.JSON(500, gin.H{"error": "K8s 操作失败: " + err.Error()}); return }
-	c.JSON(200, gin.H{"message": "配置下发/修改成功！事件监听器已接管同步..."})
+	if err != nil { return applied, 500, fmt.Errorf("K8s 操作失败: %w", err) }
+	return applied, 200, nil
+}
+
+// applyDynamicRouteYAML 通过 dynamic client 创建 / 更新 HTTPRoute 或 EdgeRoute
+func applyDynamicRouteYAML(cfg Config, applied appliedRoute, content string) (appliedRoute, int, error) {
+	kind := applied.Kind
+	gv, ok := dynamicRouteVersion(kind)
+	if !ok { return applied, 400, fmt.Errorf("集群未启用 %s", kind) }
+
+	u := &unstructured.Unstructured{}
+	jsonData, err := yaml.YAMLToJSON([]byte(content))
+	if err == nil { err = u.UnmarshalJSON(jsonData) }
+	if err != nil { return applied, 400, fmt.Errorf("YAML 格式错误") }
+	if u.GetNamespace() == "" { u.SetNamespace("default") }
+	u.SetLabels(withScopeLabels(cfg, u.GetLabels()))
+	// 统一按集群中实际提供的版本提交
+	u.SetAPIVersion(gv.String())
+
+	client, convert := dynamicRoute(kind, u.GetNamespace())
+	route, err := convert(u)
+	if err != nil { return applied, 400, fmt.Errorf("%s 格式错误: %w", kind, err) }
+	if !ingressInScope(cfg, &route) {
+		return applied, 400, fmt.Errorf("%s 不在本实例的管理范围内 (命名空间: %v, 标签选择器: %q)", kind, cfg.WatchNamespaces, cfg.LabelSelector)
+	}
+	if _, _, _, err := parseProxyOptions(cfg, route); err != nil { return applied, 400, fmt.Errorf("配置无效: %w", err) }
+
+	annotations := u.GetAnnotations()
+	if annotations == nil { annotations = make(map[string]string) }
+	annotations["kube-bt-sync.io/last-modified"] = time.Now().Format("2006-01-02 15:04:05")
+	u.SetAnnotations(annotations)
+
+	existing, err := client.Get(context.TODO(), u.GetName(), metav1.GetOptions{})
+	if err == nil {
+		applied.Previous, _ = exportDynamicRouteYAML(existing.DeepCopy())
+		u.SetResourceVersion(existing.GetResourceVersion())
+		// 覆盖时保留清理 finalizer，避免用户提交的 YAML 把它冲掉
+		if current, convErr := convert(existing); convErr == nil && hasCleanupFinalizer(current) && !hasCleanupFinalizer(route) {
+			u.SetFinalizers(append(u.GetFinalizers(), CleanupFinalizer))
+		}
+		_, err = client.Update(context.TODO(), u, metav1.UpdateOptions{})
+	} else {
+		_, err = client.Create(context.TODO(), u, metav1.CreateOptions{})
+	}
+
+	if err != nil { return applied, 500, fmt.Errorf("K8s 操作失败: %w", err) }
+	return applied, 200, nil
+}
+
+// handleGetRevisions 路由的修订列表 (按修订号倒序)
+func handleGetRevisions(c *gin.Context, k8sClient *kubernetes.Clientset, cfg Config) {
+	kind, ns, name := normalizeKind(c.Query("kind")), c.Query("ns"), c.Query("name")
+	if !namespaceInScope(cfg, ns) { c.JSON(403, gin.H{"error": "命名空间不在本实例的管理范围内"}); return }
+	revisions, err := loadRevisions(k8sClient, cfg, kind, ns, name)
+	if err != nil { c.JSON(500, gin.H{"error": "读取修订记录失败: " + err.Error()}); return }
+
+	result := make([]RouteRevision, 0, len(revisions))
+	for i := len(revisions) - 1; i >= 0; i-- { result = append(result, revisions[i]) }
+	c.JSON(200, result)
+}
+
+// handleDiffRevisions 对比两个修订，to 为空时与最新修订对比
+func handleDiffRevisions(c *gin.Context, k8sClient *kubernetes.Clientset, cfg Config) {
+	kind, ns, name := normalizeKind(c.Query("kind")), c.Query("ns"), c.Query("name")
+	if !namespaceInScope(cfg, ns) { c.JSON(403, gin.H{"error": "命名空间不在本实例的管理范围内"}); return }
+	revisions, err := loadRevisions(k8sClient, cfg, kind, ns, name)
+	if err != nil { c.JSON(500, gin.H{"error": "读取修订记录失败: " + err.Error()}); return }
+	if len(revisions) == 0 { c.JSON(404, gin.H{"error": "该路由还没有修订记录"}); return }
+
+	var fromNum, toNum int
+	fmt.Sscanf(c.Query("from"), "%d", &fromNum)
+	if _, err := fmt.Sscanf(c.Query("to"), "%d", &toNum); err != nil { toNum = revisions[len(revisions)-1].Revision }
+	from, ok1 := findRevision(revisions, fromNum)
+	to, ok2 := findRevision(revisions, toNum)
+	if !ok1 || !ok2 { c.JSON(404, gin.H{"error": "修订不存在 (可能已超出保留数量被清理)"}); return }
+
+	c.JSON(200, gin.H{"from": from.Revision, "to": to.Revision, "lines": diffLines(from.YAML, to.YAML)})
+}
+
+// handleRollbackRoute 把路由回滚到指定修订：重新下发该修订的 YAML，并记为一个新的修订
+func handleRollbackRoute(c *gin.Context, k8sClient *kubernetes.Clientset, cfg Config) {
+	var req struct {
+		Kind      string `json:"kind"`
+		Namespace string `json:"namespace" binding:"required"`
+		Name      string `json:"name" binding:"required"`
+		Revision  int    `json:"revision" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil { c.JSON(400, gin.H{"error": "参数解析失败"}); return }
+	if !namespaceInScope(cfg, req.Namespace) { c.JSON(403, gin.H{"error": "命名空间不在本实例的管理范围内"}); return }
+
+	kind := normalizeKind(req.Kind)
+	revisions, err := loadRevisions(k8sClient, cfg, kind, req.Namespace, req.Name)
+	if err != nil { c.JSON(500, gin.H{"error": "读取修订记录失败: " + err.Error()}); return }
+	target, ok := findRevision(revisions, req.Revision)
+	if !ok { c.JSON(404, gin.H{"error": "修订不存在 (可能已超出保留数量被清理)"}); return }
+
+	applied, code, err := applyRouteYAML(k8sClient, cfg, target.YAML)
+	recordAuditNow(requestActor(c), AuditActionRouteRollback, routeTarget(kind, req.Namespace, req.Name), fmt.Sprintf("回滚到修订 #%d", req.Revision), applied.Previous, target.YAML, err)
+	if err != nil { c.JSON(code, gin.H{"error": "回滚失败: " + err.Error()}); return }
+	if applied.Kind != kind || applied.Namespace != req.Namespace || applied.Name != req.Name {
+		// 修订内容总是来自同一条路由，走到这里说明 ConfigMap 被手工改过
+		slog.Warn("修订内容与回滚目标不一致", "revision", req.Revision, "kind", applied.Kind, "namespace", applied.Namespace, "ingress", applied.Name)
+	}
+
+	message := fmt.Sprintf("已回滚到修订 #%d，事件监听器已接管同步...", req.Revision)
+	if rev, err := recordRevision(k8sClient, cfg, applied, requestActor(c), RevisionActionRollback, fmt.Sprintf("回滚到 #%d", req.Revision), target.YAML); err != nil {
+		message += " (修订记录保存失败: " + err.Error() + ")"
+	} else {
+		message += fmt.Sprintf(" (修订 #%d)", rev.Revision)
+	}
+	c.JSON(200, gin.H{"message": message})
+}
+
+// handleGetAudit 查询审计日志，支持 actor / action / target / result / limit 过滤
+func handleGetAudit(c *gin.Context, k8sClient *kubernetes.Clientset, cfg Config) {
+	filter := AuditFilter{Actor: c.Query("actor"), Action: c.Query("action"), Target: c.Query("target"), Result: c.Query("result"), Limit: 200}
+	if limit := c.Query("limit"); limit != "" { fmt.Sscanf(limit, "%d", &filter.Limit) }
+	entries, err := QueryAudit(k8sClient, cfg, filter)
+	if err != nil { c.JSON(500, gin.H{"error": "读取审计日志失败: " + err.Error()}); return }
+	c.JSON(200, entries)
 }
@@ -1,19 +1,61 @@
 package main
 
 import (
-	"log"
+	"log/slog"
 	"kube-bt-sync/internal" // 引用模块
 )
 
 func main() {
-	log.Println(">>> 初始化 kube-bt-sync 环境...")
+	// 最先初始化日志，读取配置时的告警也按 LOG_LEVEL / LOG_FORMAT 输出
+	internal.InitLogger()
+
+	slog.Info("初始化 kube-bt-sync 环境...")
 	cfg := internal.LoadConfig()
 
-	log.Println(">>> 连接 K8s 集群...")
+	slog.Info("连接 K8s 集群...")
 	k8sClient := internal.InitK8sClient()
 
-	// 🌟 核心升级：废弃定时轮询，启动纯事件驱动的 K8s Watcher 雷达
-	go internal.StartIngressWatcher(k8sClient, cfg)
-	
+	// 同步结果以 K8s Event 的形式挂到 Ingress 上，kubectl describe 即可查看
+	internal.StartEventRecorder(k8sClient)
+
+	// 控制台操作与同步引擎的修改都写入审计日志 (持久化在 ConfigMap 中)
+	internal.StartAuditLog(k8sClient, cfg)
+
+	// Prometheus 指标使用独立端口 (METRICS_ADDR)，不随控制台对外暴露
+	go internal.StartMetricsServer(cfg)
+
+	// 集群安装了 Gateway API 时，HTTPRoute 与 Ingress 一起同步
+	internal.DetectGatewayAPI(k8sClient, cfg)
+
+	// 集群安装了 EdgeRoute CRD 时，EdgeRoute 与 Ingress 一起同步
+	internal.DetectEdgeRoute(k8sClient)
+
+	// 配置了 DNS_PROVIDER 时，为已同步的域名自动维护公网 DNS 记录
+	internal.InitDNSProvider(cfg)
+
+	// 多副本部署时只有 Leader 运行同步引擎，其余副本只提供控制台
+	go internal.RunAsLeader(k8sClient, cfg, func() {
+		// 先恢复持久化的同步记录，再启动消费者，避免重启后重复下发
+		internal.LoadSyncState(k8sClient, cfg)
+
+		// 同步队列消费者：所有变更都经由队列去重、限速后逐个落地到宝塔
+		go internal.StartSyncWorker(k8sClient, cfg)
+
+		// 周期性全量对账：兜底事件遗漏，并修复宝塔面板上的手动改动
+		go internal.StartSyncer(k8sClient, cfg)
+
+		// 内置 DDNS 更新器：家庭公网 IP 变化时更新 DDNS_HOST 的记录
+		go internal.StartDDNSUpdater(cfg)
+
+		// 未配置 NGINX_RESOLVER 时，DDNS 域名的 IP 变化后重载宝塔 Nginx
+		go internal.StartDDNSWatch(cfg)
+
+		// 带有 kube-bt-sync.io/expose-host 注解的 Service 自动生成 Ingress
+		internal.StartServiceWatcher(k8sClient, cfg)
+
+		// 🌟 核心升级：废弃定时轮询，启动纯事件驱动的 K8s Watcher 雷达
+		internal.StartIngressWatcher(k8sClient, cfg)
+	})
+
 	internal.StartWebServer(k8sClient, cfg)
 }